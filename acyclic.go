@@ -0,0 +1,113 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"sort"
+
+	gonum "gonum.org/v1/gonum/graph"
+)
+
+// topoOrder maintains a topological order of the nodes of an acyclic kind.  It is
+// updated incrementally as edges are added, using the algorithm of Pearce and Kelly,
+// "A Dynamic Topological Sort Algorithm for Directed Acyclic Graphs".  An edge that
+// agrees with the current order costs O(1); otherwise only the nodes between the
+// two endpoints in the order are visited.
+type topoOrder struct {
+	position map[int64]int
+	next     int
+}
+
+func newTopoOrder() *topoOrder {
+	return &topoOrder{position: map[int64]int{}}
+}
+
+func (o *topoOrder) of(id int64) int {
+	p, has := o.position[id]
+	if !has {
+		p = o.next
+		o.position[id] = p
+		o.next++
+	}
+	return p
+}
+
+// insert updates the order for a new edge from -> to.  If the edge would close a cycle,
+// the order is left unchanged and the path to -> ... -> from is returned.
+func (o *topoOrder) insert(d gonum.Directed, from, to gonum.Node) []gonum.Node {
+	if from.ID() == to.ID() {
+		return []gonum.Node{to}
+	}
+
+	lower, upper := o.of(to.ID()), o.of(from.ID())
+	if upper < lower {
+		return nil
+	}
+
+	// Nodes reachable from `to` that are not after `from` in the current order.
+	forward := []gonum.Node{}
+	parent := map[int64]gonum.Node{to.ID(): nil}
+	var found gonum.Node
+	var visitForward func(gonum.Node) bool
+	visitForward = func(n gonum.Node) bool {
+		forward = append(forward, n)
+		for _, next := range sortNodesByID(gonum.NodesOf(d.From(n.ID()))) {
+			if next.ID() == from.ID() {
+				parent[next.ID()] = n
+				found = next
+				return true
+			}
+			if _, visited := parent[next.ID()]; visited || o.of(next.ID()) > upper {
+				continue
+			}
+			parent[next.ID()] = n
+			if visitForward(next) {
+				return true
+			}
+		}
+		return false
+	}
+	if visitForward(to) {
+		path := []gonum.Node{}
+		for n := found; n != nil; n = parent[n.ID()] {
+			path = append(path, n)
+		}
+		for left, right := 0, len(path)-1; left < right; left, right = left+1, right-1 {
+			path[left], path[right] = path[right], path[left]
+		}
+		return path
+	}
+
+	// Nodes that reach `from` that are not before `to` in the current order.
+	backward := []gonum.Node{}
+	visited := map[int64]bool{from.ID(): true}
+	var visitBackward func(gonum.Node)
+	visitBackward = func(n gonum.Node) {
+		backward = append(backward, n)
+		for _, prev := range gonum.NodesOf(d.To(n.ID())) {
+			if visited[prev.ID()] || o.of(prev.ID()) < lower {
+				continue
+			}
+			visited[prev.ID()] = true
+			visitBackward(prev)
+		}
+	}
+	visitBackward(from)
+
+	// Reassign the positions held by the affected nodes so that everything that
+	// reaches `from` comes before everything reachable from `to`.
+	byPosition := func(nodes []gonum.Node) {
+		sort.Slice(nodes, func(i, j int) bool { return o.position[nodes[i].ID()] < o.position[nodes[j].ID()] })
+	}
+	byPosition(backward)
+	byPosition(forward)
+
+	affected := append(backward, forward...)
+	positions := make([]int, len(affected))
+	for i, n := range affected {
+		positions[i] = o.position[n.ID()]
+	}
+	sort.Ints(positions)
+	for i, n := range affected {
+		o.position[n.ID()] = positions[i]
+	}
+	return nil
+}
@@ -0,0 +1,118 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAcyclicAssociate(t *testing.T) {
+
+	dependsOn := EdgeKind("dependsOn")
+	other := EdgeKind("other")
+
+	g := Builder(Options{Acyclic: []EdgeKind{dependsOn}})
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	D := &nodeT{id: "D"}
+	require.NoError(t, g.Add(A, B, C, D))
+
+	// Added against the insertion order of the nodes so the order must be updated.
+	_, err := g.Associate(D, dependsOn, C)
+	require.NoError(t, err)
+	_, err = g.Associate(C, dependsOn, B)
+	require.NoError(t, err)
+	_, err = g.Associate(B, dependsOn, A)
+	require.NoError(t, err)
+	_, err = g.Associate(D, dependsOn, A)
+	require.NoError(t, err)
+
+	_, err = g.Associate(A, dependsOn, D)
+	require.Equal(t, ErrCycle{Kind: dependsOn, Path: Path{A, D, A}}, err)
+	require.Nil(t, g.Edge(A, dependsOn, D))
+
+	_, err = g.Associate(A, dependsOn, C)
+	require.Equal(t, ErrCycle{Kind: dependsOn, Path: Path{A, C, B, A}}, err)
+
+	_, err = g.Associate(B, dependsOn, B)
+	require.Equal(t, ErrCycle{Kind: dependsOn, Path: Path{B, B}}, err)
+
+	// Other kinds are not checked
+	_, err = g.Associate(A, other, D)
+	require.NoError(t, err)
+	_, err = g.Associate(D, other, A)
+	require.NoError(t, err)
+
+	sorted, err := DirectedSort(g, dependsOn)
+	require.NoError(t, err)
+	require.Equal(t, []Node{D, C, B, A}, sorted)
+}
+
+func TestAcyclicRandom(t *testing.T) {
+
+	kind := EdgeKind(1)
+	g := Builder(Options{Acyclic: []EdgeKind{kind}})
+
+	nodes := []Node{}
+	for i := 0; i < 200; i++ {
+		n := &nodeT{id: fmt.Sprintf("N%d", i)}
+		nodes = append(nodes, n)
+	}
+	require.NoError(t, g.Add(nodes[0], nodes[1:]...))
+
+	r := rand.New(rand.NewSource(42))
+	for i := 0; i < 2000; i++ {
+		from, to := nodes[r.Intn(len(nodes))], nodes[r.Intn(len(nodes))]
+
+		cyclic, err := PathExistsIn(g, kind, to, from)
+		require.NoError(t, err)
+		cyclic = cyclic || from == to
+
+		_, err = g.Associate(from, kind, to)
+		if cyclic {
+			require.IsType(t, ErrCycle{}, err)
+			cycle := err.(ErrCycle).Path
+			require.Equal(t, from, cycle[0])
+			require.Equal(t, from, cycle[len(cycle)-1])
+			continue
+		}
+		require.NoError(t, err)
+	}
+
+	// The maintained order is a valid topological order.
+	d := g.(*graph).directed[kind]
+	for _, e := range d.sortedEdges() {
+		from := g.(*graph).lookup(e.From().NodeKey())
+		to := g.(*graph).lookup(e.To().NodeKey())
+		require.True(t, d.order.position[from.id] < d.order.position[to.id])
+	}
+}
+
+func TestAcyclicLongChain(t *testing.T) {
+
+	kind := EdgeKind(1)
+	g := Builder(Options{Acyclic: []EdgeKind{kind}})
+
+	m := 20000
+	nodes := make([]Node, m)
+	for i := range nodes {
+		nodes[i] = &nodeT{id: fmt.Sprintf("N%d", i)}
+	}
+	require.NoError(t, g.Add(nodes[0], nodes[1:]...))
+
+	for i := 1; i < m; i++ {
+		_, err := g.Associate(nodes[i-1], kind, nodes[i])
+		require.NoError(t, err)
+	}
+
+	_, err := g.Associate(nodes[m-1], kind, nodes[0])
+	require.IsType(t, ErrCycle{}, err)
+	require.Equal(t, m+1, len(err.(ErrCycle).Path))
+
+	_, err = g.Associate(nodes[0], kind, nodes[m-1])
+	require.NoError(t, err)
+}
@@ -0,0 +1,247 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"sort"
+)
+
+// ConflictPolicy decides what happens when two graphs have different nodes with the same key.
+type ConflictPolicy int
+
+const (
+	// ConflictError fails with ErrDuplicateKey.
+	ConflictError ConflictPolicy = iota
+
+	// ConflictKeepFirst keeps the node of the first graph.
+	ConflictKeepFirst
+
+	// ConflictKeepSecond keeps the node of the second graph.
+	ConflictKeepSecond
+)
+
+// AlgebraOptions control Union, Intersection and Difference.
+type AlgebraOptions struct {
+
+	// Options of the new graph.
+	Options
+
+	// Conflict is the policy for nodes with the same key.  When an edge is in both graphs,
+	// the attributes are merged and the graph whose nodes are kept wins: the first graph
+	// unless the policy is ConflictKeepSecond.
+	Conflict ConflictPolicy
+}
+
+// Union returns a new graph with the nodes of both graphs and the edges of every kind
+// of both graphs.  Nodes and edges are matched by the keys of the nodes.
+func Union(a, b Graph, options AlgebraOptions) (GraphBuilder, error) {
+	return combine(a, b, options, false, func(inA, inB bool) bool { return inA || inB })
+}
+
+// Intersection returns a new graph with the nodes in both graphs and the edges of every
+// kind in both graphs.  Nodes and edges are matched by the keys of the nodes.
+func Intersection(a, b Graph, options AlgebraOptions) (GraphBuilder, error) {
+	return combine(a, b, options, false, func(inA, inB bool) bool { return inA && inB })
+}
+
+// Difference returns a new graph with the nodes and edges of the first graph that are not
+// in the second.  Nodes in both graphs are kept when they are the ends of remaining edges.
+// The nodes are always those of the first graph, so Conflict does not apply.  Nodes and
+// edges are matched by the keys of the nodes.
+func Difference(a, b Graph, options AlgebraOptions) (GraphBuilder, error) {
+	return combine(a, b, options, true, func(inA, inB bool) bool { return inA && !inB })
+}
+
+type edgeKey struct {
+	from, to interface{}
+}
+
+// combine keeps the nodes and edges for which keep is true.  With firstOnly, the nodes are
+// those of the first graph whatever the conflict policy.
+func combine(first, second Graph, options AlgebraOptions, firstOnly bool,
+	keep func(inA, inB bool) bool) (GraphBuilder, error) {
+	a, ok := first.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{first}
+	}
+	b, ok := second.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{second}
+	}
+
+	kinds := a.kinds()
+	inA := map[EdgeKind]bool{}
+	for _, kind := range kinds {
+		inA[kind] = true
+	}
+	for _, kind := range b.kinds() {
+		if !inA[kind] {
+			kinds = append(kinds, kind)
+		}
+	}
+	sortKinds(kinds)
+	sa, sb := a.snapshot(kinds), b.snapshot(kinds)
+
+	keysA, keysB := map[interface{}]*node{}, map[interface{}]*node{}
+	for _, n := range sa.nodes {
+		keysA[n.NodeKey()] = n
+	}
+	for _, n := range sb.nodes {
+		keysB[n.NodeKey()] = n
+	}
+
+	// resolve returns the node kept for the key.
+	resolve := func(key interface{}) (Node, error) {
+		na, inA := keysA[key]
+		nb, inB := keysB[key]
+		switch {
+		case !inB || (inA && firstOnly):
+			return na.Node, nil
+		case !inA:
+			return nb.Node, nil
+		case na.Node == nb.Node || options.Conflict == ConflictKeepFirst:
+			return na.Node, nil
+		case options.Conflict == ConflictKeepSecond:
+			return nb.Node, nil
+		}
+		return nil, ErrDuplicateKey{nb.Node}
+	}
+
+	result := Builder(options.Options)
+	add := func(key interface{}) error {
+		n, err := resolve(key)
+		if err != nil {
+			return err
+		}
+		return result.Add(n)
+	}
+
+	for _, nodes := range [][]*node{sa.nodes, sb.nodes} {
+		for _, n := range nodes {
+			_, inA := keysA[n.NodeKey()]
+			_, inB := keysB[n.NodeKey()]
+			if keep(inA, inB) {
+				if err := add(n.NodeKey()); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	for k, kind := range kinds {
+		edgesA, edgesB := map[edgeKey]Edge{}, map[edgeKey]Edge{}
+		ordered := []edgeKey{}
+		for _, e := range sa.edges(k) {
+			key := edgeKey{e.From().NodeKey(), e.To().NodeKey()}
+			edgesA[key] = e
+			ordered = append(ordered, key)
+		}
+		for _, e := range sb.edges(k) {
+			key := edgeKey{e.From().NodeKey(), e.To().NodeKey()}
+			edgesB[key] = e
+			if _, has := edgesA[key]; !has {
+				ordered = append(ordered, key)
+			}
+		}
+
+		for _, key := range ordered {
+			ea, inA := edgesA[key]
+			eb, inB := edgesB[key]
+			if !keep(inA, inB) {
+				continue
+			}
+			attrs := []Attribute{}
+			winners := []Edge{eb, ea}
+			if options.Conflict == ConflictKeepSecond {
+				winners = []Edge{ea, eb}
+			}
+			for _, e := range winners {
+				if e != nil {
+					attrs = append(attrs, edgeAttributes(e)...)
+				}
+			}
+
+			ends := make([]Node, 2)
+			for i, nk := range []interface{}{key.from, key.to} {
+				if err := add(nk); err != nil {
+					return nil, err
+				}
+				ends[i] = result.Node(nk)
+			}
+			if _, err := result.Associate(ends[0], kind, ends[1], attrs...); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return result, nil
+}
+
+// ComposeKinds adds an edge of the derived kind from x to z wherever there is an edge of
+// the first kind from x to some y and an edge of the second kind from y to z, for example
+// grandparent from parent and parent.  Derived edges from a node to itself are skipped.
+func ComposeKinds(g GraphBuilder, first, second, derived EdgeKind) error {
+	xg, ok := g.(*graph)
+	if !ok {
+		return ErrNotSupported{g}
+	}
+
+	s := xg.snapshot([]EdgeKind{first, second})
+	byID := map[int64]*node{}
+	for _, n := range s.nodes {
+		byID[n.id] = n
+	}
+
+	type link struct {
+		from, to Node
+	}
+	links := []link{}
+	for _, x := range s.nodes {
+		seen := map[int64]bool{x.id: true}
+		for _, y := range sortedIDs(s.out[0][x.id]) {
+			for _, z := range sortedIDs(s.out[1][y]) {
+				if !seen[z] {
+					seen[z] = true
+					links = append(links, link{from: x.Node, to: byID[z].Node})
+				}
+			}
+		}
+	}
+
+	for _, l := range links {
+		if _, err := g.Associate(l.from, derived, l.to); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// kinds returns the edge kinds of the graph ordered by their printed form.
+func (g *graph) kinds() []EdgeKind {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	kinds := make([]EdgeKind, 0, len(g.directed))
+	for kind := range g.directed {
+		kinds = append(kinds, kind)
+	}
+	sortKinds(kinds)
+	return kinds
+}
+
+// edges returns the edges of the k-th kind of the snapshot ordered by the ids of their nodes.
+func (s *snapshot) edges(k int) []Edge {
+	out := []Edge{}
+	for _, n := range s.nodes {
+		for _, to := range sortedIDs(s.out[k][n.id]) {
+			out = append(out, s.out[k][n.id][to])
+		}
+	}
+	return out
+}
+
+func sortedIDs(edges map[int64]Edge) []int64 {
+	ids := make([]int64, 0, len(edges))
+	for id := range edges {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
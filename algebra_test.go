@@ -0,0 +1,122 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func edgeKeys(g Graph, kind EdgeKind) []string {
+	out := []string{}
+	for _, e := range g.(*graph).directed[kind].sortedEdges() {
+		out = append(out, Path{e.From(), e.To()}.String())
+	}
+	return out
+}
+
+func graphKeys(g Graph) []string {
+	out := []string{}
+	for _, n := range g.(*graph).snapshot(nil).nodes {
+		out = append(out, n.NodeKey().(string))
+	}
+	return out
+}
+
+func TestGraphAlgebra(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	D := &nodeT{id: "D"}
+
+	calls := EdgeKind("calls")
+	owns := EdgeKind("owns")
+
+	first := Builder(Options{})
+	require.NoError(t, first.Add(A, B, C))
+	first.Associate(A, calls, B, Attribute{Key: "rate", Value: 1})
+	first.Associate(B, calls, C, Attribute{Key: "rate", Value: 3})
+	first.Associate(A, owns, C)
+
+	second := Builder(Options{})
+	require.NoError(t, second.Add(B, C, D))
+	second.Associate(B, calls, C)
+	second.Associate(C, calls, D, Attribute{Key: "rate", Value: 2})
+
+	union, err := Union(first, second, AlgebraOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"A", "B", "C", "D"}, graphKeys(union))
+	require.Equal(t, []string{"A -> B", "B -> C", "C -> D"}, edgeKeys(union, calls))
+	require.Equal(t, []string{"A -> C"}, edgeKeys(union, owns))
+	require.Equal(t, 2, union.Edge(C, calls, D).Attributes()["rate"])
+
+	intersection, err := Intersection(first, second, AlgebraOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"B", "C"}, graphKeys(intersection))
+	require.Equal(t, []string{"B -> C"}, edgeKeys(intersection, calls))
+	require.Nil(t, intersection.Edge(A, owns, C))
+
+	difference, err := Difference(first, second, AlgebraOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []string{"A", "B", "C"}, graphKeys(difference))
+	require.Equal(t, []string{"A -> B"}, edgeKeys(difference, calls))
+	require.Equal(t, []string{"A -> C"}, edgeKeys(difference, owns))
+
+	// A different node with the same key
+	other := Builder(Options{})
+	B2 := &nodeT{id: "B", attributes: map[string]interface{}{"version": 2}}
+	require.NoError(t, other.Add(B2, C))
+	other.Associate(B2, calls, C, Attribute{Key: "rate", Value: 5})
+
+	_, err = Union(first, other, AlgebraOptions{})
+	require.Equal(t, ErrDuplicateKey{B2}, err)
+
+	union, err = Union(first, other, AlgebraOptions{Conflict: ConflictKeepFirst})
+	require.NoError(t, err)
+	require.True(t, B == union.Node("B"))
+	require.Equal(t, 3, union.Edge(B, calls, C).Attributes()["rate"])
+
+	union, err = Union(first, other, AlgebraOptions{Conflict: ConflictKeepSecond})
+	require.NoError(t, err)
+	require.True(t, B2 == union.Node("B"))
+	require.Equal(t, 5, union.Edge(B2, calls, C).Attributes()["rate"])
+
+	// The difference takes the nodes of the first graph whatever the policy
+	for _, conflict := range []ConflictPolicy{ConflictError, ConflictKeepSecond} {
+		difference, err = Difference(first, other, AlgebraOptions{Conflict: conflict})
+		require.NoError(t, err)
+		require.Equal(t, []string{"A", "B", "C"}, graphKeys(difference))
+		require.True(t, B == difference.Node("B"))
+		require.Equal(t, []string{"A -> B"}, edgeKeys(difference, calls))
+	}
+}
+
+func TestComposeKinds(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	D := &nodeT{id: "D"}
+	E := &nodeT{id: "E"}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(A, B, C, D, E))
+
+	parent := EdgeKind("parent")
+	g.Associate(A, parent, B)
+	g.Associate(A, parent, C)
+	g.Associate(B, parent, D)
+	g.Associate(C, parent, D)
+	g.Associate(D, parent, E)
+
+	grandparent := EdgeKind("grandparent")
+	require.NoError(t, ComposeKinds(g, parent, parent, grandparent))
+	require.Equal(t, []string{"A -> D", "B -> E", "C -> E"}, edgeKeys(g, grandparent))
+
+	greatgrandparent := EdgeKind("greatgrandparent")
+	require.NoError(t, ComposeKinds(g, grandparent, parent, greatgrandparent))
+	require.Equal(t, []string{"A -> E"}, edgeKeys(g, greatgrandparent))
+
+	require.NoError(t, ComposeKinds(g, EdgeKind("none"), parent, EdgeKind("empty")))
+	require.Nil(t, g.(*graph).directed[EdgeKind("empty")])
+}
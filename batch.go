@@ -0,0 +1,178 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"sync"
+)
+
+// batch collects the errors and the events of the changes made in a transaction.
+type batch struct {
+	errors []error
+	events []Event // sent to the observers of the graph on commit
+	shared bool    // the transaction was snapshotted or cloned
+	lock   sync.Mutex
+}
+
+func (b *batch) record(err error) {
+	if b == nil || err == nil {
+		return
+	}
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.errors = append(b.errors, err)
+}
+
+// Batch calls fn with a transaction: a copy of the graph that fn changes.  If fn and all
+// the changes succeed, the graph takes the state of the transaction at once.  Otherwise
+// the graph is not changed and ErrBatch reports every error, the error of fn last.  The
+// graph is locked during the batch, so fn must only use the transaction.  The transaction of
+// a graph of a persistent Backend is a copy in memory, and the graph writes the changes made
+// by it to its stores.
+func (g *graph) Batch(fn func(tx GraphBuilder) error) error {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.readOnly {
+		return ErrReadOnly{}
+	}
+
+	persistent := g.Backend.Persistent()
+	wasShared := g.shared
+	var marked []*directed
+	var tx *graph
+	if persistent {
+		tx = g.copy(false)
+	} else {
+		g.shared = true
+		marked = g.markShared()
+		tx = g.fork(false)
+	}
+	tx.batch = &batch{}
+	err := fn(tx)
+
+	tx.lock.Lock()
+	defer tx.lock.Unlock()
+	tx.batch.lock.Lock()
+	defer tx.batch.lock.Unlock()
+
+	// The transaction cannot be used after the batch.
+	tx.readOnly = true
+
+	errs := tx.batch.errors
+	if err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		g.shared = wasShared
+		if !tx.batch.shared {
+			unmark(marked)
+		}
+		return ErrBatch{Errors: errs}
+	}
+
+	if persistent {
+		g.persist(tx)
+	} else {
+		// Kinds changed in the transaction were copied for it and now belong to the graph.
+		for _, d := range tx.directed {
+			if d.nodeConverter == tx {
+				d.nodeConverter = g
+			}
+		}
+		g.nodes, g.directed, g.nodeIndexes = tx.nodes, tx.directed, tx.nodeIndexes
+		g.shared = tx.shared && (wasShared || tx.batch.shared)
+	}
+
+	tx.nextID.lock.Lock()
+	g.nextID.lock.Lock()
+	g.nextID.value = tx.nextID.value
+	g.nextID.lock.Unlock()
+	tx.nextID.lock.Unlock()
+
+	for _, e := range tx.batch.events {
+		g.observers.publish(e)
+	}
+
+	if !tx.batch.shared {
+		unmark(marked)
+	}
+	return nil
+}
+
+// persist writes the nodes and the edges changed by the transaction to the stores of the
+// graph, and gives the graph the kinds and the indexes of the transaction on its stores.
+func (g *graph) persist(tx *graph) {
+	stores := map[EdgeKind]EdgeStore{}
+	store := func(kind EdgeKind) EdgeStore {
+		s, has := stores[kind]
+		if !has {
+			if d, exists := g.directed[kind]; exists {
+				s = d.store
+			} else {
+				s = g.Backend.EdgeStore(kind)
+			}
+			stores[kind] = s
+		}
+		return s
+	}
+
+	for _, e := range tx.batch.events {
+		switch e.Type {
+		case NodeAdded, NodeChanged, NodeRemoved:
+			key := e.Node.NodeKey()
+			old, had := g.nodes.Get(key)
+			n, has := tx.nodes.Get(key)
+			if had && (!has || n.ID != old.ID) {
+				for kind, d := range tx.directed {
+					if s := store(kind); s.HasNode(old.ID) && !d.store.HasNode(old.ID) {
+						s.RemoveNode(old.ID)
+					}
+				}
+				g.nodes.Delete(key)
+			}
+			if has {
+				g.nodes.Put(n)
+			}
+		default:
+			ed := e.Edge.(*edge)
+			from, to := ed.gonum.From().ID(), ed.gonum.To().ID()
+			if attrs, has := tx.directed[ed.kind].store.Get(from, to); has {
+				store(ed.kind).Set(from, to, attrs)
+			} else {
+				store(ed.kind).Remove(from, to)
+			}
+		}
+	}
+
+	for kind, d := range tx.directed {
+		// A kind shared with a snapshot of the transaction keeps its indexes for it.
+		if d.shared {
+			d = d.clone(g)
+		}
+		d.nodeConverter = g
+		d.store = store(kind)
+		g.directed[kind] = d
+	}
+	g.nodeIndexes = tx.nodeIndexes
+	if tx.shared {
+		g.nodeIndexes = cloneIndexes(tx.nodeIndexes)
+	}
+}
+
+// atomically makes the changes of fn in a Batch, so they are made all or none, and returns
+// the first error of the batch rather than ErrBatch.
+func (g *graph) atomically(fn func(tx GraphBuilder) error) error {
+	err := g.Batch(fn)
+	if b, is := err.(ErrBatch); is && len(b.Errors) > 0 {
+		return b.Errors[0]
+	}
+	return err
+}
+
+// unmark clears the shared mark of kinds that were marked for a transaction that is done.
+func unmark(marked []*directed) {
+	for _, d := range marked {
+		d.lock.Lock()
+		d.shared = false
+		d.lock.Unlock()
+	}
+}
@@ -0,0 +1,108 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBatch(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+
+	g := Builder(Options{NodeIndexes: []string{"team"}})
+	require.NoError(t, g.Add(A, B))
+	calls := EdgeKind("calls")
+	g.Associate(A, calls, B)
+
+	D := &nodeT{id: "D", attributes: map[string]interface{}{"team": "web"}}
+	err := g.Batch(func(tx GraphBuilder) error {
+		if err := tx.Add(C, D); err != nil {
+			return err
+		}
+		tx.Associate(B, calls, C)
+		tx.Associate(C, EdgeKind("owns"), D)
+
+		// Changes are seen in the transaction, but not in the graph yet
+		require.NotNil(t, tx.Edge(B, calls, C))
+		sorted, err := DirectedSort(tx, calls)
+		require.NoError(t, err)
+		require.Equal(t, []Node{A, B, C}, sorted)
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.Equal(t, C, g.Node("C"))
+	require.NotNil(t, g.Edge(B, calls, C))
+	require.NotNil(t, g.Edge(C, EdgeKind("owns"), D))
+	require.Equal(t, []string{"D"}, keys(g.(Indexer).NodesByAttribute("team", "web")))
+
+	// The graph is changed as usual after a batch
+	E := &nodeT{id: "E"}
+	require.NoError(t, g.Add(E))
+	g.Associate(C, calls, E)
+	require.NotNil(t, g.Edge(C, calls, E))
+}
+
+func TestBatchRollback(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(A, B))
+	calls := EdgeKind("calls")
+	g.Associate(A, calls, B)
+
+	C := &nodeT{id: "C"}
+	err := g.Batch(func(tx GraphBuilder) error {
+		tx.Add(C)
+		tx.Associate(B, calls, C)
+		tx.Associate(C, calls, &nodeT{id: "missing"})
+		tx.Add(&nodeT{id: "A"})
+		return fmt.Errorf("give up")
+	})
+	require.Error(t, err)
+	batch, is := err.(ErrBatch)
+	require.True(t, is)
+	require.Equal(t, 3, len(batch.Errors))
+	require.IsType(t, ErrNoSuchNode{}, batch.Errors[0])
+	require.IsType(t, ErrDuplicateKey{}, batch.Errors[1])
+	require.Equal(t, "give up", batch.Errors[2].Error())
+
+	require.Nil(t, g.Node("C"))
+	require.Nil(t, g.Edge(B, calls, C))
+	require.False(t, g.(*graph).directed[calls].shared)
+
+	// The transaction cannot be used after the batch
+	var leaked GraphBuilder
+	require.NoError(t, g.Batch(func(tx GraphBuilder) error {
+		leaked = tx
+		return nil
+	}))
+	require.Equal(t, ErrReadOnly{}, leaked.Add(C))
+}
+
+func TestAddAtomic(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(A))
+
+	err := g.Add(B, &nodeT{id: "C"}, &nodeT{id: "A"})
+	require.Equal(t, ErrDuplicateKey{&nodeT{id: "A"}}, err)
+	require.Nil(t, g.Node("B"))
+	require.Nil(t, g.Node("C"))
+
+	err = g.Add(B, &nodeT{id: "B"})
+	require.Error(t, err)
+	require.Nil(t, g.Node("B"))
+
+	require.NoError(t, g.Add(A, B, B))
+	require.Equal(t, B, g.Node("B"))
+}
@@ -0,0 +1,196 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"math"
+
+	gonum "gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/network"
+	"gonum.org/v1/gonum/graph/path"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// CentralityOptions control the centrality measures.
+type CentralityOptions struct {
+
+	// Damping is the PageRank damping factor.  Defaults to 0.85.
+	Damping float64
+
+	// Tolerance ends the PageRank iterations when the change is smaller.  Defaults to 1e-8.
+	Tolerance float64
+
+	// Weight gives the edge weights, for example EdgeAttributeWeight.  Edges are unweighted
+	// if nil.  For PageRank and degree the weight is the strength of the edge; for
+	// betweenness and closeness it is the length of the edge.
+	Weight EdgeWeightFunc
+
+	// Nodes restricts the measure to the subgraph of these nodes.  All the nodes of the
+	// kind are used if empty.
+	Nodes []Node
+}
+
+const (
+	defaultDamping   = 0.85
+	defaultTolerance = 1e-8
+)
+
+// PageRank returns the PageRank of the nodes of the kind.
+func PageRank(g Graph, kind EdgeKind, options CentralityOptions) (map[Node]float64, error) {
+	damping := options.Damping
+	if damping == 0 {
+		damping = defaultDamping
+	}
+	tolerance := options.Tolerance
+	if tolerance == 0 {
+		tolerance = defaultTolerance
+	}
+	return centrality(g, kind, options, func(view gonum.Directed) map[int64]float64 {
+		if view.Nodes().Len() == 0 {
+			return nil
+		}
+		return network.PageRank(view, damping, tolerance)
+	})
+}
+
+// Betweenness returns the betweenness centrality of the nodes of the kind: the number of
+// shortest paths between other nodes that go through the node.
+func Betweenness(g Graph, kind EdgeKind, options CentralityOptions) (map[Node]float64, error) {
+	return centrality(g, kind, options, func(view gonum.Directed) map[int64]float64 {
+		if weighted, is := view.(gonum.Weighted); is {
+			return network.BetweennessWeighted(weighted, path.DijkstraAllPaths(weighted))
+		}
+		return network.Betweenness(view)
+	})
+}
+
+// Closeness returns the closeness centrality of the nodes of the kind: the inverse of the
+// total distance of the shortest paths from the other nodes.  Nodes that cannot be reached
+// have a closeness of 0.
+func Closeness(g Graph, kind EdgeKind, options CentralityOptions) (map[Node]float64, error) {
+	return centrality(g, kind, options, func(view gonum.Directed) map[int64]float64 {
+		closeness := network.Closeness(view, path.DijkstraAllPaths(view))
+		for id, c := range closeness {
+			if math.IsInf(c, 0) || math.IsNaN(c) {
+				closeness[id] = 0
+			}
+		}
+		return closeness
+	})
+}
+
+// InDegree returns the in degree centrality of the nodes of the kind: the total weight of
+// the edges to the node, divided by the number of other nodes.
+func InDegree(g Graph, kind EdgeKind, options CentralityOptions) (map[Node]float64, error) {
+	return centrality(g, kind, options, func(view gonum.Directed) map[int64]float64 {
+		return degree(view, view.To, func(u, v int64) (int64, int64) { return v, u })
+	})
+}
+
+// OutDegree returns the out degree centrality of the nodes of the kind: the total weight of
+// the edges from the node, divided by the number of other nodes.
+func OutDegree(g Graph, kind EdgeKind, options CentralityOptions) (map[Node]float64, error) {
+	return centrality(g, kind, options, func(view gonum.Directed) map[int64]float64 {
+		return degree(view, view.From, func(u, v int64) (int64, int64) { return u, v })
+	})
+}
+
+func degree(view gonum.Directed, neighbors func(int64) gonum.Nodes,
+	edge func(u, v int64) (int64, int64)) map[int64]float64 {
+
+	nodes := gonum.NodesOf(view.Nodes())
+	others := float64(len(nodes) - 1)
+	if others < 1 {
+		others = 1
+	}
+	weighted, isWeighted := view.(gonum.Weighted)
+
+	result := map[int64]float64{}
+	for _, n := range nodes {
+		sum := 0.
+		for _, other := range gonum.NodesOf(neighbors(n.ID())) {
+			if !isWeighted {
+				sum++
+				continue
+			}
+			w, _ := weighted.Weight(edge(n.ID(), other.ID()))
+			sum += w
+		}
+		result[n.ID()] = sum / others
+	}
+	return result
+}
+
+func centrality(g Graph, kind EdgeKind, options CentralityOptions,
+	measure func(gonum.Directed) map[int64]float64) (result map[Node]float64, err error) {
+
+	result = map[Node]float64{}
+	err = scopeDirected(g, kind,
+
+		func(dg *directed) error {
+			dg.lock.RLock()
+			view := dg.view(options.Nodes, options.Weight)
+			dg.lock.RUnlock()
+
+			values := measure(view)
+			for _, n := range gonum.NodesOf(view.Nodes()) {
+				result[dg.xgraph(n)[0]] = values[n.ID()]
+			}
+			return nil
+		})
+	return
+}
+
+// view copies the subgraph induced by the given nodes, or the whole graph if there are none.
+// If weight is not nil, the copy is a weighted graph.
+func (d *directed) view(subset []Node, weight EdgeWeightFunc) gonum.Directed {
+	include := func(int64) bool { return true }
+	if len(subset) > 0 {
+		ids := map[int64]bool{}
+		for _, n := range d.gonum(subset[0], subset[1:]...) {
+			if n != nil {
+				ids[n.ID()] = true
+			}
+		}
+		include = func(id int64) bool { return ids[id] }
+	}
+
+	nodes := []gonum.Node{}
+	for _, n := range d.sortedNodes() {
+		if include(n.ID()) {
+			nodes = append(nodes, n)
+		}
+	}
+	type arc struct {
+		from, to gonum.Node
+		weight   float64
+	}
+	arcs := []arc{}
+	for _, e := range d.storedEdges() {
+		if include(e.from) && include(e.to) {
+			a := arc{from: d.Node(e.from), to: d.Node(e.to)}
+			if weight != nil {
+				a.weight = weight(e.Edge)
+			}
+			arcs = append(arcs, a)
+		}
+	}
+
+	if weight == nil {
+		view := simple.NewDirectedGraph()
+		for _, n := range nodes {
+			view.AddNode(n)
+		}
+		for _, a := range arcs {
+			view.SetEdge(view.NewEdge(a.from, a.to))
+		}
+		return view
+	}
+
+	view := simple.NewWeightedDirectedGraph(0, math.Inf(1))
+	for _, n := range nodes {
+		view.AddNode(n)
+	}
+	for _, a := range arcs {
+		view.SetWeightedEdge(view.NewWeightedEdge(a.from, a.to, a.weight))
+	}
+	return view
+}
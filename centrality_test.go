@@ -0,0 +1,76 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCentrality(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	D := &nodeT{id: "D"}
+	E := &nodeT{id: "E"}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(A, B, C, D, E))
+
+	// A, B and C all depend on D, which depends on E
+	deps := EdgeKind("deps")
+	g.Associate(A, deps, D, Attribute{Key: "calls", Value: 1})
+	g.Associate(B, deps, D, Attribute{Key: "calls", Value: 2})
+	g.Associate(C, deps, D, Attribute{Key: "calls", Value: 7})
+	g.Associate(D, deps, E, Attribute{Key: "calls", Value: 10})
+	g.Associate(A, deps, B, Attribute{Key: "calls", Value: 1})
+
+	rank, err := PageRank(g, deps, CentralityOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 5, len(rank))
+	require.True(t, rank[E] > rank[D])
+	require.True(t, rank[D] > rank[B])
+	require.True(t, rank[B] > rank[A])
+	require.InDelta(t, rank[A], rank[C], 1e-6)
+
+	between, err := Betweenness(g, deps, CentralityOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[Node]float64{A: 0, B: 0, C: 0, D: 3, E: 0}, between)
+
+	closeness, err := Closeness(g, deps, CentralityOptions{})
+	require.NoError(t, err)
+	require.Equal(t, float64(0), closeness[A])
+	require.Equal(t, float64(1), closeness[B])
+	require.Equal(t, 1/float64(1+1+1), closeness[D])
+	require.Equal(t, 1/float64(2+2+2+1), closeness[E])
+
+	in, err := InDegree(g, deps, CentralityOptions{})
+	require.NoError(t, err)
+	require.Equal(t, map[Node]float64{A: 0, B: 0.25, C: 0, D: 0.75, E: 0.25}, in)
+
+	out, err := OutDegree(g, deps, CentralityOptions{Weight: EdgeAttributeWeight("calls", 1)})
+	require.NoError(t, err)
+	require.Equal(t, map[Node]float64{A: 0.5, B: 0.5, C: 1.75, D: 2.5, E: 0}, out)
+
+	in, err = InDegree(g, deps, CentralityOptions{Weight: EdgeAttributeWeight("calls", 1)})
+	require.NoError(t, err)
+	require.Equal(t, float64(10)/4, in[D])
+
+	// Only the subgraph of A, B and D
+	in, err = InDegree(g, deps, CentralityOptions{Nodes: []Node{A, B, D}})
+	require.NoError(t, err)
+	require.Equal(t, map[Node]float64{A: 0, B: 0.5, D: 1}, in)
+
+	// A long path through B is shorter by weight
+	g.Associate(A, deps, E, Attribute{Key: "calls", Value: 100})
+	between, err = Betweenness(g, deps, CentralityOptions{})
+	require.NoError(t, err)
+	require.Equal(t, float64(2), between[D])
+	between, err = Betweenness(g, deps, CentralityOptions{Weight: EdgeAttributeWeight("calls", 1)})
+	require.NoError(t, err)
+	require.Equal(t, float64(3), between[D])
+
+	rank, err = PageRank(g, EdgeKind("none"), CentralityOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 0, len(rank))
+}
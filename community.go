@@ -0,0 +1,211 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+
+	exprand "golang.org/x/exp/rand"
+	gonum "gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/community"
+	"gonum.org/v1/gonum/graph/simple"
+)
+
+// Communities assigns nodes to communities, numbered from 0.
+type Communities map[Node]int
+
+// CommunityOptions control community detection.
+type CommunityOptions struct {
+
+	// Weight gives the edge weights.  Every edge weighs 1 if nil.
+	Weight EdgeWeightFunc
+
+	// Resolution of the modularity for Louvain.  Higher values give smaller communities.
+	// Defaults to 1.
+	Resolution float64
+
+	// MaxIterations limits the rounds of label propagation.  Defaults to 100.
+	MaxIterations int
+
+	// Seed for the random choices, so results can be reproduced.
+	Seed int64
+}
+
+const defaultMaxIterations = 100
+
+// Louvain detects communities by maximizing modularity with the Louvain method.
+// The edges of all the kinds are combined, ignoring their direction.
+func Louvain(g Graph, kinds []EdgeKind, options CommunityOptions) (Communities, error) {
+	resolution := options.Resolution
+	if resolution == 0 {
+		resolution = 1
+	}
+	return detectCommunities(g, kinds, options, func(u *simple.WeightedUndirectedGraph) [][]gonum.Node {
+		if u.Nodes().Len() == 0 {
+			return nil
+		}
+		reduced := community.Modularize(u, resolution, exprand.NewSource(uint64(options.Seed)))
+		return reduced.Communities()
+	})
+}
+
+// LabelPropagation detects communities by label propagation: every node starts in its own
+// community and repeatedly joins the community with the most weight among its neighbors.
+// The edges of all the kinds are combined, ignoring their direction.
+func LabelPropagation(g Graph, kinds []EdgeKind, options CommunityOptions) (Communities, error) {
+	iterations := options.MaxIterations
+	if iterations <= 0 {
+		iterations = defaultMaxIterations
+	}
+	return detectCommunities(g, kinds, options, func(u *simple.WeightedUndirectedGraph) [][]gonum.Node {
+		return propagateLabels(u, iterations, rand.New(rand.NewSource(options.Seed)))
+	})
+}
+
+func propagateLabels(u *simple.WeightedUndirectedGraph, iterations int, r *rand.Rand) [][]gonum.Node {
+	nodes := sortNodesByID(gonum.NodesOf(u.Nodes()))
+	label := map[int64]int64{}
+	for _, n := range nodes {
+		label[n.ID()] = n.ID()
+	}
+
+	for i := 0; i < iterations; i++ {
+		changed := false
+		for _, j := range r.Perm(len(nodes)) {
+			n := nodes[j]
+			weights := map[int64]float64{}
+			for _, other := range gonum.NodesOf(u.From(n.ID())) {
+				w, _ := u.Weight(n.ID(), other.ID())
+				weights[label[other.ID()]] += w
+			}
+			if len(weights) == 0 {
+				continue
+			}
+			// Keep the current label on a tie so the propagation settles, otherwise
+			// take the smallest label.
+			best, bestWeight := int64(0), math.Inf(-1)
+			for l, w := range weights {
+				if w > bestWeight || (w == bestWeight && l < best) {
+					best, bestWeight = l, w
+				}
+			}
+			if weights[label[n.ID()]] == bestWeight {
+				best = label[n.ID()]
+			}
+			if best != label[n.ID()] {
+				label[n.ID()] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+
+	groups := map[int64][]gonum.Node{}
+	for _, n := range nodes {
+		groups[label[n.ID()]] = append(groups[label[n.ID()]], n)
+	}
+	out := [][]gonum.Node{}
+	for _, group := range groups {
+		out = append(out, group)
+	}
+	return out
+}
+
+func detectCommunities(g Graph, kinds []EdgeKind, options CommunityOptions,
+	detect func(*simple.WeightedUndirectedGraph) [][]gonum.Node) (Communities, error) {
+
+	xg, ok := g.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{g}
+	}
+	weight := options.Weight
+	if weight == nil {
+		weight = unitWeight
+	}
+
+	u := simple.NewWeightedUndirectedGraph(0, 0)
+	for _, kind := range kinds {
+		xg.lock.RLock()
+		d, has := xg.directed[kind]
+		xg.lock.RUnlock()
+		if !has {
+			continue
+		}
+
+		d.lock.RLock()
+		for _, n := range d.sortedNodes() {
+			if u.Node(n.ID()) == nil {
+				u.AddNode(n)
+			}
+		}
+		for _, e := range d.storedEdges() {
+			from, to := d.Node(e.from), d.Node(e.to)
+			w, _ := u.Weight(e.from, e.to)
+			u.SetWeightedEdge(u.NewWeightedEdge(from, to, w+weight(e.Edge)))
+		}
+		d.lock.RUnlock()
+	}
+
+	// Number the communities by their first member in the order nodes were added.
+	groups := detect(u)
+	for _, group := range groups {
+		sortNodesByID(group)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0].ID() < groups[j][0].ID() })
+
+	communities := Communities{}
+	for i, group := range groups {
+		for _, n := range group {
+			communities[n.(*node).Node] = i
+		}
+	}
+	return communities, nil
+}
+
+// Clusters returns the nodes of each community, indexed by community number.
+func (c Communities) Clusters() [][]Node {
+	clusters := [][]Node{}
+	for n, i := range c {
+		for len(clusters) <= i {
+			clusters = append(clusters, []Node{})
+		}
+		clusters[i] = append(clusters[i], n)
+	}
+	for _, cluster := range clusters {
+		SortNodes(cluster, func(a, b Node) bool {
+			return fmt.Sprintf("%v", a.NodeKey()) < fmt.Sprintf("%v", b.NodeKey())
+		})
+	}
+	return clusters
+}
+
+// DotClusters returns the community of each node as a cluster label for DotOptions.Clusters.
+func (c Communities) DotClusters() map[Node]string {
+	labels := map[Node]string{}
+	for n, i := range c {
+		labels[n] = fmt.Sprintf("community%d", i)
+	}
+	return labels
+}
+
+// Annotate sets the community number as the attribute key of every node.  The nodes must be
+// AttributeSetters.  Either every node is annotated or, on error, none of them.
+func (c Communities) Annotate(g Graph, key string) error {
+	xg, ok := g.(*graph)
+	if !ok {
+		return ErrNotSupported{g}
+	}
+	return xg.atomically(func(tx GraphBuilder) error {
+		for i, cluster := range c.Clusters() {
+			for _, n := range cluster {
+				if err := SetAttributes(tx, n, Attribute{Key: key, Value: i}); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,94 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testDataModules(t *testing.T) (GraphBuilder, []EdgeKind, []Node) {
+
+	nodes := []Node{}
+	for _, id := range []string{"a1", "a2", "a3", "a4", "b1", "b2", "b3", "b4"} {
+		nodes = append(nodes, &nodeT{id: id})
+	}
+
+	g := Builder(Options{NodeIndexes: []string{"module"}})
+	require.NoError(t, g.Add(nodes[0], nodes[1:]...))
+
+	// Two tightly coupled groups with a single call between them, spread over two kinds.
+	calls := EdgeKind("calls")
+	imports := EdgeKind("imports")
+	for _, group := range [][]Node{nodes[:4], nodes[4:]} {
+		for i := range group {
+			for j := i + 1; j < len(group); j++ {
+				kind := calls
+				if (i+j)%2 == 0 {
+					kind = imports
+				}
+				_, err := g.Associate(group[i], kind, group[j])
+				require.NoError(t, err)
+			}
+		}
+	}
+	_, err := g.Associate(nodes[3], calls, nodes[4])
+	require.NoError(t, err)
+
+	return g, []EdgeKind{calls, imports}, nodes
+}
+
+func TestCommunities(t *testing.T) {
+
+	g, kinds, nodes := testDataModules(t)
+	expect := Communities{}
+	for i, n := range nodes {
+		expect[n] = i / 4
+	}
+
+	louvain, err := Louvain(g, kinds, CommunityOptions{Seed: 1})
+	require.NoError(t, err)
+	require.Equal(t, expect, louvain)
+
+	propagated, err := LabelPropagation(g, kinds, CommunityOptions{Seed: 1})
+	require.NoError(t, err)
+	require.Equal(t, expect, propagated)
+
+	require.Equal(t, [][]Node{nodes[:4], nodes[4:]}, louvain.Clusters())
+
+	// Every node of the kinds is assigned, even with some edges left out
+	single, err := Louvain(g, kinds[:1], CommunityOptions{Seed: 1})
+	require.NoError(t, err)
+	require.Equal(t, len(nodes), len(single))
+
+	empty, err := Louvain(g, []EdgeKind{EdgeKind("none")}, CommunityOptions{})
+	require.NoError(t, err)
+	require.Equal(t, Communities{}, empty)
+
+	_, err = LabelPropagation(nil, kinds, CommunityOptions{})
+	require.Error(t, err)
+}
+
+func TestCommunitiesAnnotate(t *testing.T) {
+
+	g, kinds, nodes := testDataModules(t)
+
+	communities, err := Louvain(g, kinds, CommunityOptions{Seed: 1})
+	require.NoError(t, err)
+	require.NoError(t, communities.Annotate(g, "module"))
+
+	require.Equal(t, 1, nodes[5].(Attributer).Attributes()["module"])
+	require.Equal(t, NodeSlice(nodes[4:]), g.(Indexer).NodesByAttribute("module", 1))
+
+	require.Error(t, SetAttributes(g, &nodeT{id: "other"}, Attribute{Key: "module", Value: 2}))
+
+	// Nodes are annotated all or none
+	partial := Communities{nodes[0]: 0, &nodeT{id: "other"}: 1}
+	require.Equal(t, ErrNoSuchNode{Node: &nodeT{id: "other"}, context: "set"}, partial.Annotate(g, "partial"))
+	require.Equal(t, 0, len(g.(Indexer).NodesByAttribute("partial", 0)))
+
+	buff, err := EncodeDot(g, DotOptions{Clusters: communities.DotClusters()})
+	require.NoError(t, err)
+	require.Contains(t, string(buff), "subgraph cluster_community0 {")
+	require.Contains(t, string(buff), "subgraph cluster_community1 {")
+	t.Log(string(buff))
+}
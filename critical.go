@@ -0,0 +1,104 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"math"
+)
+
+// Schedule is the timing of a node in a critical path analysis.  Slack is how much
+// the node can be delayed without delaying the whole graph; it is 0 on the critical path.
+type Schedule struct {
+	EarliestStart  float64
+	EarliestFinish float64
+	LatestStart    float64
+	LatestFinish   float64
+	Slack          float64
+}
+
+// CriticalPathResult is the longest weighted path through a kind and the schedule
+// of every node of the kind.
+type CriticalPathResult struct {
+	Path     Path
+	Total    float64
+	Schedule map[Node]Schedule
+}
+
+// CriticalPath finds the longest path through an acyclic kind, where each node takes
+// the time given by the node weight and each edge adds the delay given by the edge
+// weight.  Either weight function may be nil, for a weight of 0.  The kind is ordered
+// by DirectedSort, so a kind with cycles returns ErrUnorderable.
+func CriticalPath(g Graph, kind EdgeKind, nodeWeight NodeWeightFunc,
+	edgeWeight EdgeWeightFunc) (*CriticalPathResult, error) {
+
+	if nodeWeight == nil {
+		nodeWeight = func(Node) float64 { return 0 }
+	}
+	if edgeWeight == nil {
+		edgeWeight = func(Edge) float64 { return 0 }
+	}
+
+	sorted, err := DirectedSort(g, kind)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CriticalPathResult{Path: Path{}, Schedule: map[Node]Schedule{}}
+	if len(sorted) == 0 {
+		return result, nil
+	}
+
+	duration := map[Node]float64{}
+	for _, n := range sorted {
+		duration[n] = nodeWeight(n)
+	}
+
+	// Forward pass for the earliest times.
+	schedule := result.Schedule
+	last := sorted[0]
+	for _, n := range sorted {
+		s := Schedule{}
+		for _, e := range g.To(kind, n).Edges().Slice() {
+			if start := schedule[e.From()].EarliestFinish + edgeWeight(e); start > s.EarliestStart {
+				s.EarliestStart = start
+			}
+		}
+		s.EarliestFinish = s.EarliestStart + duration[n]
+		schedule[n] = s
+		if s.EarliestFinish > schedule[last].EarliestFinish {
+			last = n
+		}
+	}
+	result.Total = schedule[last].EarliestFinish
+
+	// Backward pass for the latest times.
+	for i := len(sorted) - 1; i >= 0; i-- {
+		n := sorted[i]
+		s := schedule[n]
+		s.LatestFinish = result.Total
+		for _, e := range g.From(n, kind).Edges().Slice() {
+			if finish := schedule[e.To()].LatestStart - edgeWeight(e); finish < s.LatestFinish {
+				s.LatestFinish = finish
+			}
+		}
+		s.LatestStart = s.LatestFinish - duration[n]
+		s.Slack = s.LatestStart - s.EarliestStart
+		schedule[n] = s
+	}
+
+	// Walk back from the node that finishes last through the predecessors that
+	// determine each earliest start.
+	for n := last; n != nil; {
+		result.Path = append(result.Path, n)
+		var prev Node
+		for _, e := range g.To(kind, n).Edges().Slice() {
+			finish := schedule[e.From()].EarliestFinish + edgeWeight(e)
+			if math.Abs(finish-schedule[n].EarliestStart) <= 1e-9*math.Max(1, math.Abs(finish)) {
+				if prev == nil || schedule[e.From()].Slack < schedule[prev].Slack {
+					prev = e.From()
+				}
+			}
+		}
+		n = prev
+	}
+	Reverse(result.Path)
+	return result, nil
+}
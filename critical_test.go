@@ -0,0 +1,67 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCriticalPath(t *testing.T) {
+
+	task := func(id string, duration float64) *nodeT {
+		return &nodeT{id: id, attributes: map[string]interface{}{"duration": duration}}
+	}
+
+	start := task("start", 0)
+	fetch := task("fetch", 2)
+	compile := task("compile", 5)
+	lint := task("lint", 1)
+	test := task("test", 3)
+	docs := task("docs", 2)
+	release := task("release", 1)
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(start, fetch, compile, lint, test, docs, release))
+
+	then := EdgeKind("then")
+	g.Associate(start, then, fetch)
+	g.Associate(fetch, then, compile)
+	g.Associate(fetch, then, lint)
+	g.Associate(fetch, then, docs)
+	g.Associate(compile, then, test)
+	g.Associate(lint, then, test)
+	g.Associate(test, then, release)
+	g.Associate(docs, then, release, Attribute{Key: "wait", Value: 7})
+
+	result, err := CriticalPath(g, then, NodeAttributeWeight("duration", 0), nil)
+	require.NoError(t, err)
+	require.Equal(t, Path{start, fetch, compile, test, release}, result.Path)
+	require.Equal(t, float64(11), result.Total)
+	require.Equal(t, Schedule{EarliestStart: 2, EarliestFinish: 3, LatestStart: 6, LatestFinish: 7, Slack: 4},
+		result.Schedule[lint])
+	require.Equal(t, Schedule{EarliestStart: 2, EarliestFinish: 7, LatestStart: 2, LatestFinish: 7},
+		result.Schedule[compile])
+	require.Equal(t, float64(6), result.Schedule[docs].Slack)
+
+	// With the delay on the edge, docs becomes critical.
+	result, err = CriticalPath(g, then, NodeAttributeWeight("duration", 0), EdgeAttributeWeight("wait", 0))
+	require.NoError(t, err)
+	require.Equal(t, Path{start, fetch, docs, release}, result.Path)
+	require.Equal(t, float64(11+1), result.Total)
+	require.Equal(t, float64(0), result.Schedule[docs].Slack)
+	require.Equal(t, float64(1), result.Schedule[compile].Slack)
+
+	// Unweighted: the longest path by number of edges
+	result, err = CriticalPath(g, then, nil, func(Edge) float64 { return 1 })
+	require.NoError(t, err)
+	require.Equal(t, float64(4), result.Total)
+	require.Equal(t, 5, len(result.Path))
+
+	result, err = CriticalPath(g, EdgeKind("none"), nil, nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(result.Path))
+
+	g.Associate(release, then, start)
+	_, err = CriticalPath(g, then, nil, nil)
+	require.IsType(t, ErrUnorderable{}, err)
+}
@@ -0,0 +1,272 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// AttributeChange is a changed attribute.  Old or New is nil if the attribute was added
+// or removed.
+type AttributeChange struct {
+	Key string
+	Old interface{}
+	New interface{}
+}
+
+// NodeChange is a node with the same key in both graphs but different attributes.
+type NodeChange struct {
+	Old     Node
+	New     Node
+	Changes []AttributeChange
+}
+
+// EdgeChange is an edge of the same kind between the same nodes in both graphs but with
+// different attributes.
+type EdgeChange struct {
+	Old     Edge
+	New     Edge
+	Changes []AttributeChange
+}
+
+// GraphDiff is the difference between two graphs.  Nodes are matched by key, and edges by
+// kind and the keys of their nodes.  Removed nodes and edges are from the old graph; added
+// ones from the new graph.
+type GraphDiff struct {
+	AddedNodes   NodeSlice
+	RemovedNodes NodeSlice
+	ChangedNodes []NodeChange
+
+	AddedEdges   map[EdgeKind]EdgeSlice
+	RemovedEdges map[EdgeKind]EdgeSlice
+	ChangedEdges map[EdgeKind][]EdgeChange
+
+	before, after *graph
+}
+
+// Diff compares the graphs a (old) and b (new).  The diff keeps snapshots of both, so later
+// changes to the graphs are not seen by EncodeDiffDot.
+func Diff(a, b Graph) (*GraphDiff, error) {
+	xa, ok := a.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{a}
+	}
+	xb, ok := b.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{b}
+	}
+	xa, xb = xa.share(true), xb.share(true)
+
+	kinds := xa.kinds()
+	inA := map[EdgeKind]bool{}
+	for _, kind := range kinds {
+		inA[kind] = true
+	}
+	for _, kind := range xb.kinds() {
+		if !inA[kind] {
+			kinds = append(kinds, kind)
+		}
+	}
+	sortKinds(kinds)
+	sa, sb := xa.snapshot(kinds), xb.snapshot(kinds)
+
+	d := &GraphDiff{
+		AddedNodes:   NodeSlice{},
+		RemovedNodes: NodeSlice{},
+		ChangedNodes: []NodeChange{},
+		AddedEdges:   map[EdgeKind]EdgeSlice{},
+		RemovedEdges: map[EdgeKind]EdgeSlice{},
+		ChangedEdges: map[EdgeKind][]EdgeChange{},
+		before:       xa,
+		after:        xb,
+	}
+
+	keysB := map[interface{}]*node{}
+	for _, n := range sb.nodes {
+		keysB[n.NodeKey()] = n
+	}
+	keysA := map[interface{}]bool{}
+	for _, n := range sa.nodes {
+		keysA[n.NodeKey()] = true
+		nb, has := keysB[n.NodeKey()]
+		if !has {
+			d.RemovedNodes = append(d.RemovedNodes, n.Node)
+			continue
+		}
+		if changes := diffAttributes(n.attributes, nb.attributes); len(changes) > 0 {
+			d.ChangedNodes = append(d.ChangedNodes, NodeChange{Old: n.Node, New: nb.Node, Changes: changes})
+		}
+	}
+	for _, n := range sb.nodes {
+		if !keysA[n.NodeKey()] {
+			d.AddedNodes = append(d.AddedNodes, n.Node)
+		}
+	}
+
+	for k, kind := range kinds {
+		edgesB := map[edgeKey]Edge{}
+		for _, e := range sb.edges(k) {
+			edgesB[edgeKey{e.From().NodeKey(), e.To().NodeKey()}] = e
+		}
+		inA := map[edgeKey]bool{}
+		for _, e := range sa.edges(k) {
+			key := edgeKey{e.From().NodeKey(), e.To().NodeKey()}
+			inA[key] = true
+			eb, has := edgesB[key]
+			if !has {
+				d.RemovedEdges[kind] = append(d.RemovedEdges[kind], e)
+				continue
+			}
+			if changes := diffAttributes(e.Attributes(), eb.Attributes()); len(changes) > 0 {
+				d.ChangedEdges[kind] = append(d.ChangedEdges[kind], EdgeChange{Old: e, New: eb, Changes: changes})
+			}
+		}
+		for _, e := range sb.edges(k) {
+			if !inA[edgeKey{e.From().NodeKey(), e.To().NodeKey()}] {
+				d.AddedEdges[kind] = append(d.AddedEdges[kind], e)
+			}
+		}
+	}
+	return d, nil
+}
+
+func diffAttributes(before, after map[string]interface{}) []AttributeChange {
+	keys := []string{}
+	for k := range before {
+		keys = append(keys, k)
+	}
+	for k := range after {
+		if _, has := before[k]; !has {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	changes := []AttributeChange{}
+	for _, k := range keys {
+		if !reflect.DeepEqual(before[k], after[k]) {
+			changes = append(changes, AttributeChange{Key: k, Old: before[k], New: after[k]})
+		}
+	}
+	return changes
+}
+
+// Empty tells if the graphs are the same.
+func (d *GraphDiff) Empty() bool {
+	return len(d.AddedNodes) == 0 && len(d.RemovedNodes) == 0 && len(d.ChangedNodes) == 0 &&
+		len(d.AddedEdges) == 0 && len(d.RemovedEdges) == 0 && len(d.ChangedEdges) == 0
+}
+
+// kinds returns the kinds with changed edges ordered by their printed form.
+func (d *GraphDiff) kinds() []EdgeKind {
+	seen := map[EdgeKind]bool{}
+	kinds := []EdgeKind{}
+	for _, m := range []map[EdgeKind]EdgeSlice{d.RemovedEdges, d.AddedEdges} {
+		for kind := range m {
+			if !seen[kind] {
+				seen[kind] = true
+				kinds = append(kinds, kind)
+			}
+		}
+	}
+	for kind := range d.ChangedEdges {
+		if !seen[kind] {
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+	sortKinds(kinds)
+	return kinds
+}
+
+// String renders the diff as text, one change per line: + for added, - for removed and
+// ~ for changed nodes and edges.
+func (d *GraphDiff) String() string {
+	lines := []string{}
+	for _, n := range d.RemovedNodes {
+		lines = append(lines, fmt.Sprintf("- node %v", n.NodeKey()))
+	}
+	for _, n := range d.AddedNodes {
+		lines = append(lines, fmt.Sprintf("+ node %v", n.NodeKey()))
+	}
+	for _, c := range d.ChangedNodes {
+		lines = append(lines, fmt.Sprintf("~ node %v:%s", c.New.NodeKey(), changesString(c.Changes)))
+	}
+	for _, kind := range d.kinds() {
+		for _, e := range d.RemovedEdges[kind] {
+			lines = append(lines, fmt.Sprintf("- %v: %v", kind, Path{e.From(), e.To()}))
+		}
+		for _, e := range d.AddedEdges[kind] {
+			lines = append(lines, fmt.Sprintf("+ %v: %v", kind, Path{e.From(), e.To()}))
+		}
+		for _, c := range d.ChangedEdges[kind] {
+			lines = append(lines, fmt.Sprintf("~ %v: %v:%s", kind, Path{c.New.From(), c.New.To()}, changesString(c.Changes)))
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+func changesString(changes []AttributeChange) string {
+	s := ""
+	for _, c := range changes {
+		s += fmt.Sprintf(" %s %v -> %v", c.Key, c.Old, c.New)
+	}
+	return s
+}
+
+// Diff colors for EncodeDiffDot.
+const (
+	DiffAdded   = EdgeColor("green")
+	DiffRemoved = EdgeColor("red")
+	DiffChanged = EdgeColor("orange")
+)
+
+// EncodeDiffDot renders the union of the old and new graphs in dot format with the added
+// nodes and edges in DiffAdded, the removed ones in DiffRemoved, and the changed ones in
+// DiffChanged.  Changed nodes and edges are drawn as in the new graph.
+func EncodeDiffDot(d *GraphDiff, options DotOptions) ([]byte, error) {
+	union, err := Union(d.after, d.before, AlgebraOptions{Conflict: ConflictKeepFirst})
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := map[Node]map[string]string{}
+	color := func(n Node, c EdgeColor) {
+		nodes[union.Node(n.NodeKey())] = map[string]string{"color": string(c), "fontcolor": string(c)}
+	}
+	for _, n := range d.AddedNodes {
+		color(n, DiffAdded)
+	}
+	for _, n := range d.RemovedNodes {
+		color(n, DiffRemoved)
+	}
+	for _, c := range d.ChangedNodes {
+		color(c.New, DiffChanged)
+	}
+
+	edges := map[Edge]map[string]string{}
+	colorEdge := func(kind EdgeKind, e Edge, c EdgeColor) {
+		from, to := union.Node(e.From().NodeKey()), union.Node(e.To().NodeKey())
+		edges[union.Edge(from, kind, to)] = map[string]string{"color": string(c), "fontcolor": string(c)}
+	}
+	for kind, slice := range d.AddedEdges {
+		for _, e := range slice {
+			colorEdge(kind, e, DiffAdded)
+		}
+	}
+	for kind, slice := range d.RemovedEdges {
+		for _, e := range slice {
+			colorEdge(kind, e, DiffRemoved)
+		}
+	}
+	for kind, changes := range d.ChangedEdges {
+		for _, c := range changes {
+			colorEdge(kind, c.New, DiffChanged)
+		}
+	}
+
+	options.NodeAttributes = nodes
+	options.EdgeAttributes = edges
+	return EncodeDot(union, options)
+}
@@ -0,0 +1,85 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiff(t *testing.T) {
+
+	calls := EdgeKind("calls")
+	owns := EdgeKind("owns")
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B", attributes: map[string]interface{}{"version": 1}}
+	C := &nodeT{id: "C"}
+
+	old := Builder(Options{})
+	require.NoError(t, old.Add(A, B, C))
+	old.Associate(A, calls, B, Attribute{Key: "rate", Value: 1})
+	old.Associate(B, calls, C)
+	old.Associate(A, owns, C)
+
+	B2 := &nodeT{id: "B", attributes: map[string]interface{}{"version": 2}}
+	C2 := &nodeT{id: "C"}
+	D := &nodeT{id: "D"}
+
+	updated := Builder(Options{})
+	require.NoError(t, updated.Add(B2, C2, D))
+	updated.Associate(B2, calls, C2, Attribute{Key: "rate", Value: 3})
+	updated.Associate(C2, calls, D)
+	updated.Associate(D, owns, C2)
+
+	d, err := Diff(old, updated)
+	require.NoError(t, err)
+	require.False(t, d.Empty())
+
+	require.Equal(t, NodeSlice{A}, d.RemovedNodes)
+	require.Equal(t, NodeSlice{D}, d.AddedNodes)
+	require.Equal(t, []NodeChange{
+		{Old: B, New: B2, Changes: []AttributeChange{{Key: "version", Old: 1, New: 2}}},
+	}, d.ChangedNodes)
+
+	require.Equal(t, map[EdgeKind]EdgeSlice{
+		calls: {old.Edge(A, calls, B)},
+		owns:  {old.Edge(A, owns, C)},
+	}, d.RemovedEdges)
+	require.Equal(t, map[EdgeKind]EdgeSlice{
+		calls: {updated.Edge(C2, calls, D)},
+		owns:  {updated.Edge(D, owns, C2)},
+	}, d.AddedEdges)
+	require.Equal(t, []AttributeChange{{Key: "rate", Old: nil, New: 3}}, d.ChangedEdges[calls][0].Changes)
+
+	require.Equal(t, `- node A
++ node D
+~ node B: version 1 -> 2
+- calls: A -> B
++ calls: C -> D
+~ calls: B -> C: rate <nil> -> 3
+- owns: A -> C
++ owns: D -> C`, d.String())
+
+	buff, err := EncodeDiffDot(d, DotOptions{})
+	require.NoError(t, err)
+	dot := string(buff)
+	t.Log(dot)
+	require.Contains(t, dot, "color=red")
+	require.Contains(t, dot, "color=green")
+	require.Contains(t, dot, "color=orange")
+
+	// Later changes to the graphs are not rendered
+	require.NoError(t, updated.Remove(D))
+	require.NoError(t, old.Disassociate(A, calls, B))
+	buff, err = EncodeDiffDot(d, DotOptions{})
+	require.NoError(t, err)
+	dot = string(buff)
+	require.Contains(t, dot, "C -> D")
+	require.Contains(t, dot, "A -> B")
+	require.Contains(t, dot, "color=green")
+
+	same, err := Diff(old, old)
+	require.NoError(t, err)
+	require.True(t, same.Empty())
+	require.Equal(t, "", same.String())
+}
@@ -1,53 +1,328 @@
 package xgraph // import "github.com/orkestr8/xgraph"
 
 import (
+	"container/heap"
+	"fmt"
+	"sort"
 	"sync"
 
 	gonum "gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/iterator"
 	"gonum.org/v1/gonum/graph/simple"
 	"gonum.org/v1/gonum/graph/topo"
 )
 
 func newDirected(base *graph, kind EdgeKind) *directed {
-	return &directed{
-		kind:            kind,
-		nodeConverter:   base,
-		DirectedBuilder: simple.NewDirectedGraph(),
-		edges:           map[gonum.Edge]*edge{},
+	d := &directed{
+		kind:          kind,
+		schema:        base.kindSchema(kind),
+		nodeConverter: base,
+		store:         base.Backend.EdgeStore(kind),
+		values:        &edgeValues{edges: map[[2]int64]*edge{}},
+		indexes:       newIndexes(base.EdgeIndexes),
 	}
+	if d.schema != nil && d.schema.Acyclic {
+		d.order = newTopoOrder()
+	}
+	for _, k := range base.Reachability {
+		if k == kind {
+			d.reachIndexed = true
+		}
+	}
+	return d
 }
 
+// directed is the graph of a kind.  It is a gonum.Directed on the store of the kind, for
+// the algorithms.
 type directed struct {
 	nodeConverter
-	gonum.DirectedBuilder
-	edges map[gonum.Edge]*edge
-	kind  EdgeKind
+	store   EdgeStore
+	values  *edgeValues
+	kind    EdgeKind
+	indexes map[string]*index
+	schema  *KindSchema
+	order   *topoOrder // maintained only for acyclic kinds
+	shared  bool       // shared with a snapshot or clone, so never changed again
+
+	reachIndexed bool          // keeps a reachability index for PathExistsIn
+	reach        *reachability // nil until queried, and after changes to the paths
+	reachLock    sync.Mutex
 
 	lock sync.RWMutex
 }
 
-func (d *directed) associate(fromNode, toNode *node, attrs ...Attribute) *edge {
+func (d *directed) associate(emit func(Event), fromNode, toNode *node, attrs ...Attribute) (*edge, error) {
 	d.lock.Lock()
 	defer d.lock.Unlock()
 
-	if d.Node(fromNode.id) == nil {
-		d.AddNode(fromNode)
-	}
-	if d.Node(toNode.id) == nil {
-		d.AddNode(toNode)
+	if d.schema != nil {
+		if err := d.schema.checkEdge(d, fromNode, toNode, attrs); err != nil {
+			return nil, err
+		}
 	}
 
 	ed := &edge{
-		gonum:      d.NewEdge(fromNode, toNode),
+		gonum:      simple.Edge{F: fromNode, T: toNode},
 		kind:       d.kind,
 		to:         toNode.Node,
 		from:       fromNode.Node,
 		attributes: attrs,
 	}
-	d.edges[ed.gonum] = ed
-	d.SetEdge(ed.gonum)
+	if d.reachIndexed && !d.keepsReach(fromNode.id, toNode.id) {
+		d.invalidateReach()
+	}
+	event := Event{Type: EdgeAssociated, Edge: ed}
+	if old := d.edge(fromNode.id, toNode.id); old != nil {
+		event = Event{Type: EdgeChanged, Edge: ed, Old: old}
+		d.unindexEdge(fromNode.id, toNode.id)
+	}
+	d.store.Set(fromNode.id, toNode.id, attrs)
+	d.values.set(fromNode.id, toNode.id, ed)
+	d.indexEdge(ed, fromNode, toNode)
+	emit(event)
 
-	return ed //&edgeView{ed}
+	return ed, nil //&edgeView{ed}
+}
+
+// disassociate removes the edge from -> to and returns it, or nil if there is none.
+func (d *directed) disassociate(emit func(Event), from, to int64) Edge {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.removeEdge(emit, from, to)
+}
+
+func (d *directed) removeEdge(emit func(Event), from, to int64) Edge {
+	e := d.edge(from, to)
+	if e == nil {
+		return nil
+	}
+	d.unindexEdge(from, to)
+	d.store.Remove(from, to)
+	d.values.set(from, to, nil)
+	if d.reachIndexed {
+		d.invalidateReach()
+	}
+	emit(Event{Type: EdgeDisassociated, Edge: e})
+	return e
+}
+
+// removeNode removes the node and its edges, the edges from it first.
+func (d *directed) removeNode(emit func(Event), n *node) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if !d.store.HasNode(n.id) {
+		return
+	}
+	for _, to := range sortNodesByID(gonum.NodesOf(d.From(n.id))) {
+		d.removeEdge(emit, n.id, to.ID())
+	}
+	for _, from := range sortNodesByID(gonum.NodesOf(d.To(n.id))) {
+		d.removeEdge(emit, from.ID(), n.id)
+	}
+	d.store.RemoveNode(n.id)
+	if d.reachIndexed {
+		d.invalidateReach()
+	}
+	if d.order != nil {
+		delete(d.order.position, n.id)
+	}
+}
+
+// edge returns the edge from -> to, or nil if there is none.  The edge is made from the
+// store the first time, and the same edge is returned after.
+func (d *directed) edge(from, to int64) Edge {
+	d.values.lock.Lock()
+	defer d.values.lock.Unlock()
+
+	if e, has := d.values.edges[[2]int64{from, to}]; has {
+		return e
+	}
+	attrs, has := d.store.Get(from, to)
+	if !has {
+		return nil
+	}
+	fromNode, toNode := d.nodeByID(from), d.nodeByID(to)
+	if fromNode == nil || toNode == nil {
+		return nil
+	}
+	e := &edge{
+		gonum:      simple.Edge{F: fromNode, T: toNode},
+		kind:       d.kind,
+		from:       fromNode.Node,
+		to:         toNode.Node,
+		attributes: attrs,
+	}
+	d.values.edges[[2]int64{from, to}] = e
+	return e
+}
+
+// edgeValues are the edges made from the store of a kind, so the graph returns the same
+// value for an edge each time.  The graphs sharing the store share them.
+type edgeValues struct {
+	edges map[[2]int64]*edge
+	lock  sync.Mutex
+}
+
+// set sets the edge from -> to, or removes it if nil.
+func (v *edgeValues) set(from, to int64, e *edge) {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	if e == nil {
+		delete(v.edges, [2]int64{from, to})
+		return
+	}
+	v.edges[[2]int64{from, to}] = e
+}
+
+// copy returns a copy of the edges, for a copy of the store.
+func (v *edgeValues) copy() *edgeValues {
+	v.lock.Lock()
+	defer v.lock.Unlock()
+
+	c := &edgeValues{edges: make(map[[2]int64]*edge, len(v.edges))}
+	for ends, e := range v.edges {
+		c.edges[ends] = e
+	}
+	return c
+}
+
+// Node returns the node of the id if it has edges of the kind, or nil.
+func (d *directed) Node(id int64) gonum.Node {
+	if !d.store.HasNode(id) {
+		return nil
+	}
+	if n := d.nodeByID(id); n != nil {
+		return n
+	}
+	return nil
+}
+
+// Nodes returns the nodes with edges of the kind.
+func (d *directed) Nodes() gonum.Nodes {
+	return d.nodesOf(d.store.Nodes())
+}
+
+// From returns the nodes with an edge of the kind from the node of the id.
+func (d *directed) From(id int64) gonum.Nodes {
+	return d.nodesOf(d.store.From(id))
+}
+
+// To returns the nodes with an edge of the kind to the node of the id.
+func (d *directed) To(id int64) gonum.Nodes {
+	return d.nodesOf(d.store.To(id))
+}
+
+func (d *directed) HasEdgeBetween(x, y int64) bool {
+	return d.HasEdgeFromTo(x, y) || d.HasEdgeFromTo(y, x)
+}
+
+func (d *directed) HasEdgeFromTo(u, v int64) bool {
+	_, has := d.store.Get(u, v)
+	return has
+}
+
+func (d *directed) Edge(u, v int64) gonum.Edge {
+	if !d.HasEdgeFromTo(u, v) {
+		return nil
+	}
+	from, to := d.nodeByID(u), d.nodeByID(v)
+	if from == nil || to == nil {
+		return nil
+	}
+	return simple.Edge{F: from, T: to}
+}
+
+func (d *directed) nodesOf(ids []int64) gonum.Nodes {
+	if len(ids) == 0 {
+		return gonum.Empty
+	}
+	nodes := make([]gonum.Node, 0, len(ids))
+	for _, id := range ids {
+		if n := d.nodeByID(id); n != nil {
+			nodes = append(nodes, n)
+		}
+	}
+	return iterator.NewOrderedNodes(nodes)
+}
+
+// path returns the shortest path from -> to in this graph, or nil if there is none.
+func (d *directed) path(from, to *node) []gonum.Node {
+	if d.Node(from.id) == nil || d.Node(to.id) == nil {
+		return nil
+	}
+	parent := map[int64]gonum.Node{from.id: nil}
+	queue := []gonum.Node{from}
+	for len(queue) > 0 {
+		this := queue[0]
+		queue = queue[1:]
+		if this.ID() == to.id {
+			path := []gonum.Node{}
+			for n := this; n != nil; n = parent[n.ID()] {
+				path = append(path, n)
+			}
+			for left, right := 0, len(path)-1; left < right; left, right = left+1, right-1 {
+				path[left], path[right] = path[right], path[left]
+			}
+			return path
+		}
+		for _, next := range sortNodesByID(gonum.NodesOf(d.From(this.ID()))) {
+			if _, visited := parent[next.ID()]; !visited {
+				parent[next.ID()] = this
+				queue = append(queue, next)
+			}
+		}
+	}
+	return nil
+}
+
+// sortedNodes returns the nodes of this graph ordered by id.
+func (d *directed) sortedNodes() []gonum.Node {
+	return sortNodesByID(gonum.NodesOf(d.Nodes()))
+}
+
+// storedEdge is an edge of the store of a kind, with the ids of its nodes.
+type storedEdge struct {
+	Edge
+	from, to int64
+}
+
+// storedEdges returns the edges of this graph ordered by the ids of the from and to nodes.
+func (d *directed) storedEdges() []storedEdge {
+	ends := make([][2]int64, 0, d.store.Len())
+	d.store.Range(func(from, to int64, _ []Attribute) bool {
+		ends = append(ends, [2]int64{from, to})
+		return true
+	})
+	all := make([]storedEdge, 0, len(ends))
+	for _, e := range ends {
+		if ed := d.edge(e[0], e[1]); ed != nil {
+			all = append(all, storedEdge{Edge: ed, from: e[0], to: e[1]})
+		}
+	}
+	sort.Slice(all, func(i, j int) bool {
+		return indexOrder{all[i].from, all[i].to}.less(indexOrder{all[j].from, all[j].to})
+	})
+	return all
+}
+
+// sortedEdges is storedEdges as edges of this package.
+func (d *directed) sortedEdges() []*edge {
+	stored := d.storedEdges()
+	out := make([]*edge, len(stored))
+	for i, e := range stored {
+		out[i] = e.Edge.(*edge)
+	}
+	return out
+}
+
+// sortKinds orders edge kinds by their printed form.
+func sortKinds(kinds []EdgeKind) {
+	sort.Slice(kinds, func(i, j int) bool {
+		return fmt.Sprintf("%v", kinds[i]) < fmt.Sprintf("%v", kinds[j])
+	})
 }
 
 func scopeDirected(g Graph, kind EdgeKind, do func(*directed) error) error {
@@ -78,11 +353,17 @@ func DirectedCycles(g Graph, kind EdgeKind) (cycles []Path, err error) {
 }
 
 func DirectedSort(g Graph, kind EdgeKind) (sorted []Node, err error) {
+	if f, is := g.(*Frozen); is {
+		return f.sort(kind)
+	}
 	err = scopeDirected(g, kind,
 
 		func(dg *directed) error {
 			sorted = []Node{}
 			s, err := topo.Sort(dg)
+			if unorderable, is := err.(topo.Unorderable); is {
+				return dg.unorderable(unorderable)
+			}
 			if err != nil {
 				return err
 			}
@@ -93,11 +374,164 @@ func DirectedSort(g Graph, kind EdgeKind) (sorted []Node, err error) {
 	return
 }
 
+// DirectedSortStable sorts the nodes of the kind topologically.  When more than one node
+// can come next, the least by the less function is chosen, so the result is the same
+// every time for the same graph.  If less is nil, nodes are ordered by when they were
+// added to the graph.
+func DirectedSortStable(g Graph, kind EdgeKind, less func(a, b Node) bool) (sorted []Node, err error) {
+	err = scopeDirected(g, kind,
+
+		func(dg *directed) error {
+			dg.lock.RLock()
+			defer dg.lock.RUnlock()
+
+			ready := &nodeHeap{less: less}
+			inDegree := map[int64]int{}
+			for _, n := range dg.sortedNodes() {
+				inDegree[n.ID()] = dg.To(n.ID()).Len()
+				if inDegree[n.ID()] == 0 {
+					heap.Push(ready, n.(*node))
+				}
+			}
+
+			sorted = []Node{}
+			for ready.Len() > 0 {
+				this := heap.Pop(ready).(*node)
+				sorted = append(sorted, dg.xgraph(this)[0])
+				for _, next := range gonum.NodesOf(dg.From(this.id)) {
+					inDegree[next.ID()]--
+					if inDegree[next.ID()] == 0 {
+						heap.Push(ready, next.(*node))
+					}
+				}
+			}
+			if len(sorted) < len(inDegree) {
+				return dg.unsortable()
+			}
+			return nil
+		})
+	return
+}
+
+// DirectedLayers groups the nodes of the kind into layers where every edge goes from an
+// earlier layer to a later one, so the nodes within a layer do not depend on each other.
+// A node is placed in the layer after the last of its predecessors (the longest path
+// from any source); sources are in the first layer.  Nodes in a layer are ordered by
+// when they were added to the graph.
+func DirectedLayers(g Graph, kind EdgeKind) (layers [][]Node, err error) {
+	err = scopeDirected(g, kind,
+
+		func(dg *directed) error {
+			dg.lock.RLock()
+			defer dg.lock.RUnlock()
+
+			layer := map[int64]int{}
+			inDegree := map[int64]int{}
+			ready := []gonum.Node{}
+			for _, n := range dg.sortedNodes() {
+				inDegree[n.ID()] = dg.To(n.ID()).Len()
+				if inDegree[n.ID()] == 0 {
+					ready = append(ready, n)
+				}
+			}
+
+			visited := 0
+			buckets := [][]gonum.Node{}
+			for len(ready) > 0 {
+				this := ready[0]
+				ready = ready[1:]
+				visited++
+
+				l := layer[this.ID()]
+				for len(buckets) <= l {
+					buckets = append(buckets, []gonum.Node{})
+				}
+				buckets[l] = append(buckets[l], this)
+
+				for _, next := range gonum.NodesOf(dg.From(this.ID())) {
+					if layer[next.ID()] < l+1 {
+						layer[next.ID()] = l + 1
+					}
+					inDegree[next.ID()]--
+					if inDegree[next.ID()] == 0 {
+						ready = append(ready, next)
+					}
+				}
+			}
+			if visited < len(inDegree) {
+				return dg.unsortable()
+			}
+
+			layers = [][]Node{}
+			for _, bucket := range buckets {
+				sortNodesByID(bucket)
+				layers = append(layers, dg.xgraph(bucket[0], bucket[1:]...))
+			}
+			return nil
+		})
+	return
+}
+
+// unsortable returns the error for a kind that has cycles.
+func (d *directed) unsortable() error {
+	_, err := topo.Sort(d)
+	if unorderable, is := err.(topo.Unorderable); is {
+		return d.unorderable(unorderable)
+	}
+	return err
+}
+
+// nodeHeap is a min heap of nodes by the less function, or by id if it is nil.
+type nodeHeap struct {
+	nodes []*node
+	less  func(a, b Node) bool
+}
+
+func (h *nodeHeap) Len() int { return len(h.nodes) }
+
+func (h *nodeHeap) Less(i, j int) bool {
+	if h.less != nil {
+		if h.less(h.nodes[i].Node, h.nodes[j].Node) {
+			return true
+		}
+		if h.less(h.nodes[j].Node, h.nodes[i].Node) {
+			return false
+		}
+	}
+	return h.nodes[i].id < h.nodes[j].id
+}
+
+func (h *nodeHeap) Swap(i, j int) { h.nodes[i], h.nodes[j] = h.nodes[j], h.nodes[i] }
+
+func (h *nodeHeap) Push(x interface{}) { h.nodes = append(h.nodes, x.(*node)) }
+
+func (h *nodeHeap) Pop() interface{} {
+	x := h.nodes[len(h.nodes)-1]
+	h.nodes = h.nodes[:len(h.nodes)-1]
+	return x
+}
+
+// unorderable converts gonum's error to one with the xgraph nodes of the blocking components.
+func (d *directed) unorderable(components topo.Unorderable) ErrUnorderable {
+	err := ErrUnorderable{Kind: d.kind, Components: []Path{}, Cycles: []Path{}}
+	for _, c := range components {
+		err.Components = append(err.Components, d.xgraph(c[0], c[1:]...))
+		err.Cycles = append(err.Cycles, d.cycleIn(c))
+	}
+	return err
+}
+
 func PathExistsIn(g Graph, kind EdgeKind, from, to Node) (exists bool, err error) {
 	err = scopeDirected(g, kind,
 
 		func(dg *directed) error {
 			args := dg.gonum(from, to)
+			if dg.reachIndexed && args[0] != nil && args[1] != nil {
+				dg.lock.RLock()
+				defer dg.lock.RUnlock()
+				exists = dg.reachable().reaches(args[0].ID(), args[1].ID())
+				return nil
+			}
 			exists = topo.PathExistsIn(dg, args[0], args[1])
 			return nil
 		})
@@ -58,7 +58,7 @@ func TestScopeDirected(t *testing.T) {
 		func(dg *directed) error {
 			require.NotNil(t, dg)
 
-			count = len(dg.edges)
+			count = dg.store.Len()
 			return nil
 		})
 	require.NoError(t, err)
@@ -255,3 +255,104 @@ func TestGraphQueries(t *testing.T) {
 	require.Equal(t, m, len(g.To(likes, g.Node("David")).Nodes().Slice()))
 	require.Equal(t, m*2, len(g.From(g.Node("David"), likes).Nodes().Slice()))
 }
+
+func TestDirectedSortUnorderable(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	D := &nodeT{id: "D"}
+	E := &nodeT{id: "E"}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(A, B, C, D, E))
+
+	refs := EdgeKind("refs")
+
+	g.Associate(A, refs, B)
+	g.Associate(B, refs, C)
+	g.Associate(C, refs, B)
+	g.Associate(C, refs, D)
+	g.Associate(D, refs, E)
+	g.Associate(E, refs, D)
+
+	_, err := DirectedSort(g, refs)
+	require.Error(t, err)
+
+	unorderable, is := err.(ErrUnorderable)
+	require.True(t, is)
+	require.Equal(t, refs, unorderable.Kind)
+	require.Equal(t, []Path{{B, C}, {D, E}}, unorderable.Components)
+	require.Equal(t, []Path{{B, C, B}, {D, E, D}}, unorderable.Cycles)
+	require.Equal(t, "Cannot sort refs, cycles:B -> C -> B; D -> E -> D", err.Error())
+}
+
+func TestDirectedSortStable(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	D := &nodeT{id: "D"}
+	E := &nodeT{id: "E"}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(E, D, C, B, A))
+
+	deps := EdgeKind(1)
+	g.Associate(A, deps, D)
+	g.Associate(B, deps, D)
+	g.Associate(C, deps, E)
+	g.Associate(D, deps, E)
+
+	byKey := func(a, b Node) bool {
+		return a.NodeKey().(string) < b.NodeKey().(string)
+	}
+
+	for i := 0; i < 10; i++ {
+		sorted, err := DirectedSortStable(g, deps, byKey)
+		require.NoError(t, err)
+		require.Equal(t, []Node{A, B, C, D, E}, sorted)
+	}
+
+	// By insertion order
+	sorted, err := DirectedSortStable(g, deps, nil)
+	require.NoError(t, err)
+	require.Equal(t, []Node{C, B, A, D, E}, sorted)
+
+	g.Associate(E, deps, B)
+	_, err = DirectedSortStable(g, deps, byKey)
+	require.Equal(t, "Cannot sort 1, cycles:E -> B -> D -> E", err.Error())
+}
+
+func TestDirectedLayers(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	D := &nodeT{id: "D"}
+	E := &nodeT{id: "E"}
+	F := &nodeT{id: "F"}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(A, B, C, D, E, F))
+
+	deps := EdgeKind(1)
+	g.Associate(A, deps, B)
+	g.Associate(B, deps, C)
+	g.Associate(A, deps, C)
+	g.Associate(D, deps, C)
+	g.Associate(C, deps, E)
+	g.Associate(D, deps, F)
+
+	layers, err := DirectedLayers(g, deps)
+	require.NoError(t, err)
+	require.Equal(t, [][]Node{{A, D}, {B, F}, {C}, {E}}, layers)
+
+	layers, err = DirectedLayers(g, EdgeKind(2))
+	require.NoError(t, err)
+	require.Nil(t, layers)
+
+	g.Associate(E, deps, A)
+	_, err = DirectedLayers(g, deps)
+	require.IsType(t, ErrUnorderable{}, err)
+}
@@ -0,0 +1,153 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"sort"
+
+	gonum "gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/flow"
+)
+
+// Dominators computes the dominator tree of the kind from the root with the algorithm of
+// Lengauer and Tarjan.  A node d dominates n if every path from the root to n goes through d.
+// The tree is added to the graph as edges of the tree kind, from each immediate dominator
+// to the nodes it immediately dominates, and the immediate dominators are returned.  Nodes
+// not reachable from the root are not in the tree.  The tree kind may not have edges yet,
+// and the tree is added all at once or, on error, not at all.
+func Dominators(g GraphBuilder, kind EdgeKind, root Node, tree EdgeKind) (map[Node]Node, error) {
+	xg, ok := g.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{g}
+	}
+	if xg.gonum(root)[0] == nil {
+		return nil, ErrNoSuchNode{Node: root, context: "root"}
+	}
+
+	type link struct {
+		dominator, node Node
+	}
+	links := []link{}
+	err := scopeDirected(g, kind,
+
+		func(dg *directed) error {
+			dg.lock.RLock()
+			defer dg.lock.RUnlock()
+
+			r := dg.gonum(root)[0]
+			if dg.Node(r.ID()) == nil {
+				return nil
+			}
+			dominators := flow.Dominators(r, dg)
+			for _, n := range dg.sortedNodes() {
+				if dominator := dominators.DominatorOf(n.ID()); dominator != nil {
+					links = append(links, link{
+						dominator: dg.xgraph(dominator)[0],
+						node:      dg.xgraph(n)[0],
+					})
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	err = xg.atomically(func(tx GraphBuilder) error {
+		if d, has := tx.(*graph).directed[tree]; has && d.store.Len() > 0 {
+			return ErrKindNotEmpty{Kind: tree}
+		}
+		for _, l := range links {
+			if _, err := tx.Associate(l.dominator, tree, l.node); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	idom := map[Node]Node{}
+	for _, l := range links {
+		idom[l.node] = l.dominator
+	}
+	return idom, nil
+}
+
+// LowestCommonAncestors returns the lowest common ancestors of a and b in the kind, which
+// must be acyclic.  A node is an ancestor of itself and of the nodes it has a path to.
+// A common ancestor is lowest if none of the nodes it has a path to is also a common
+// ancestor; in a DAG there can be more than one.  The nodes are ordered by when they were
+// added to the graph.
+func LowestCommonAncestors(g Graph, kind EdgeKind, a, b Node) (lowest []Node, err error) {
+	xg, ok := g.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{g}
+	}
+	ends := xg.gonum(a, b)
+	if ends[0] == nil {
+		return nil, ErrNoSuchNode{Node: a, context: "a"}
+	}
+	if ends[1] == nil {
+		return nil, ErrNoSuchNode{Node: b, context: "b"}
+	}
+
+	lowest = []Node{}
+	err = scopeDirected(g, kind,
+
+		func(dg *directed) error {
+			dg.lock.RLock()
+			defer dg.lock.RUnlock()
+
+			if dg.order == nil {
+				if err := dg.unsortable(); err != nil {
+					return err
+				}
+			}
+			if dg.Node(ends[0].ID()) == nil || dg.Node(ends[1].ID()) == nil {
+				return nil
+			}
+
+			common, other := dg.ancestors(ends[0]), dg.ancestors(ends[1])
+			for id := range common {
+				if !other[id] {
+					delete(common, id)
+				}
+			}
+
+			found := []gonum.Node{}
+			for id := range common {
+				isLowest := true
+				for _, next := range gonum.NodesOf(dg.From(id)) {
+					if common[next.ID()] {
+						isLowest = false
+						break
+					}
+				}
+				if isLowest {
+					found = append(found, dg.Node(id))
+				}
+			}
+			sort.Slice(found, func(i, j int) bool { return found[i].ID() < found[j].ID() })
+			for _, n := range found {
+				lowest = append(lowest, dg.xgraph(n)[0])
+			}
+			return nil
+		})
+	return
+}
+
+// ancestors returns the ids of the nodes with a path to n, including n.
+func (d *directed) ancestors(n gonum.Node) map[int64]bool {
+	seen := map[int64]bool{n.ID(): true}
+	stack := []int64{n.ID()}
+	for len(stack) > 0 {
+		this := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		for _, prev := range gonum.NodesOf(d.To(this)) {
+			if !seen[prev.ID()] {
+				seen[prev.ID()] = true
+				stack = append(stack, prev.ID())
+			}
+		}
+	}
+	return seen
+}
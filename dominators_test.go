@@ -0,0 +1,110 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDominators(t *testing.T) {
+
+	R := &nodeT{id: "R"}
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	D := &nodeT{id: "D"}
+	E := &nodeT{id: "E"}
+	X := &nodeT{id: "X"}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(R, A, B, C, D, E, X))
+
+	flows := EdgeKind("flows")
+	g.Associate(R, flows, A)
+	g.Associate(R, flows, B)
+	g.Associate(A, flows, C)
+	g.Associate(B, flows, C)
+	g.Associate(C, flows, D)
+	g.Associate(D, flows, C) // loop
+	g.Associate(D, flows, E)
+	g.Associate(X, flows, E) // X is not reachable from R
+
+	dominates := EdgeKind("dominates")
+	idom, err := Dominators(g, flows, R, dominates)
+	require.NoError(t, err)
+	require.Equal(t, map[Node]Node{A: R, B: R, C: R, D: C, E: D}, idom)
+
+	children := keys(g.From(R, dominates).Nodes().Slice())
+	sort.Strings(children)
+	require.Equal(t, []string{"A", "B", "C"}, children)
+	require.Equal(t, NodeSlice{D}, g.To(dominates, E).Nodes().Slice())
+
+	sorted, err := DirectedSort(g, dominates)
+	require.NoError(t, err)
+	require.Equal(t, R, sorted[0])
+
+	_, err = Dominators(g, flows, &nodeT{id: "none"}, dominates)
+	require.Error(t, err)
+
+	// The tree kind must be new, and a tree is added all or none
+	_, err = Dominators(g, flows, R, dominates)
+	require.Equal(t, ErrKindNotEmpty{Kind: dominates}, err)
+
+	limited := Builder(Options{Schema: &Schema{Kinds: map[EdgeKind]KindSchema{dominates: {MaxOut: 1}}}})
+	require.NoError(t, limited.Add(R, A, B))
+	limited.Associate(R, flows, A)
+	limited.Associate(R, flows, B)
+	_, err = Dominators(limited, flows, R, dominates)
+	require.IsType(t, ErrCardinality{}, err)
+	require.Equal(t, 0, len(limited.From(R, dominates).Nodes().Slice()))
+
+	idom, err = Dominators(g, EdgeKind("none"), R, EdgeKind("empty"))
+	require.NoError(t, err)
+	require.Equal(t, 0, len(idom))
+}
+
+func TestLowestCommonAncestors(t *testing.T) {
+
+	X := &nodeT{id: "X"}
+	Y := &nodeT{id: "Y"}
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	D := &nodeT{id: "D"}
+	Z := &nodeT{id: "Z"}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(X, Y, A, B, C, D, Z))
+
+	owns := EdgeKind("owns")
+	g.Associate(X, owns, A)
+	g.Associate(Y, owns, A)
+	g.Associate(X, owns, B)
+	g.Associate(Y, owns, B)
+	g.Associate(A, owns, C)
+	g.Associate(A, owns, D)
+
+	lca, err := LowestCommonAncestors(g, owns, A, B)
+	require.NoError(t, err)
+	require.Equal(t, []Node{X, Y}, lca)
+
+	lca, err = LowestCommonAncestors(g, owns, C, D)
+	require.NoError(t, err)
+	require.Equal(t, []Node{A}, lca)
+
+	lca, err = LowestCommonAncestors(g, owns, A, D)
+	require.NoError(t, err)
+	require.Equal(t, []Node{A}, lca)
+
+	lca, err = LowestCommonAncestors(g, owns, C, Z)
+	require.NoError(t, err)
+	require.Equal(t, []Node{}, lca)
+
+	_, err = LowestCommonAncestors(g, owns, C, &nodeT{id: "none"})
+	require.Error(t, err)
+
+	g.Associate(D, owns, X)
+	_, err = LowestCommonAncestors(g, owns, C, D)
+	require.IsType(t, ErrUnorderable{}, err)
+}
@@ -2,11 +2,15 @@ package xgraph // import "github.com/orkestr8/xgraph"
 
 import (
 	"fmt"
+	"sort"
+	"strconv"
 	"strings"
 
 	gonum "gonum.org/v1/gonum/graph"
 	"gonum.org/v1/gonum/graph/encoding"
 	"gonum.org/v1/gonum/graph/encoding/dot"
+	dotformat "gonum.org/v1/gonum/graph/formats/dot"
+	"gonum.org/v1/gonum/graph/formats/dot/ast"
 	"gonum.org/v1/gonum/graph/simple"
 )
 
@@ -20,6 +24,17 @@ func (a attributes) Attributes() []encoding.Attribute {
 	return out
 }
 
+func dotAttributes(m map[string]interface{}) attributes {
+	attr := attributes{}
+	for k, v := range m {
+		attr[k] = fmt.Sprintf("%v", v)
+	}
+	return attr
+}
+
+// descriptionKey is the subgraph attribute of the description of a kind.
+const descriptionKey = "description"
+
 // For encoding to dotfile, dotNode is a view of the Node.
 // It implements dot related methods and labeling.
 // For decoding it also implements the Setter interfaces called when
@@ -41,10 +56,6 @@ func (n dotNode) DOTID() string {
 	return fmt.Sprintf("%v", n.key)
 }
 
-func (n *dotNode) SetDOTID(id string) {
-	n.key = NodeKey(id)
-}
-
 func (n dotNode) ID() int64 {
 	return int64(n.id)
 }
@@ -124,8 +135,9 @@ type dotGraph struct {
 	DotOptions
 	gonum.Directed
 
-	kind EdgeKind // set only when it's a subgraph
-	xg   *graph
+	kind    EdgeKind // set only when it's a subgraph
+	cluster string   // set only when it's a cluster subgraph
+	xg      *graph
 }
 
 func (dg *dotGraph) dotNode(gn gonum.Node) gonum.Node {
@@ -153,9 +165,10 @@ func (dg *dotGraph) dotNode(gn gonum.Node) gonum.Node {
 		return dn
 	}
 	return &dotNode{
-		key:     v[0].NodeKey(),
-		id:      gn.ID(),
-		labeler: labeler,
+		key:        v[0].NodeKey(),
+		id:         gn.ID(),
+		labeler:    labeler,
+		attributes: dg.DotOptions.NodeAttributes[v[0]],
 	}
 }
 
@@ -163,15 +176,16 @@ func (dg *dotGraph) dotEdge(e gonum.Edge) gonum.Edge {
 	if de, is := e.(*dotEdge); is {
 		return de
 	}
-	xedge, has := dg.xg.directed[dg.kind].edges[e]
-	if !has {
+	xedge := dg.xg.directed[dg.kind].edge(e.From().ID(), e.To().ID())
+	if xedge == nil {
 		return e
 	}
 
 	return &dotEdge{
-		edge: xedge,
-		from: e.From(),
-		to:   e.To(),
+		edge:  xedge,
+		from:  e.From(),
+		to:    e.To(),
+		extra: dg.DotOptions.EdgeAttributes[xedge],
 	}
 }
 
@@ -181,6 +195,9 @@ func (dg *dotGraph) Node(id int64) gonum.Node {
 }
 
 func (dg *dotGraph) DOTID() string {
+	if dg.cluster != "" {
+		return "cluster_" + dg.cluster
+	}
 	if dg.kind == nil {
 		id := dg.Name
 		if id == "" {
@@ -189,14 +206,15 @@ func (dg *dotGraph) DOTID() string {
 		return id
 	}
 
-	dotid := fmt.Sprintf("%v", dg.kind)
-	if dg.DotOptions.Edges != nil {
-		if v, has := dg.DotOptions.Edges[dg.kind]; has {
-			dotid = v
-		}
-		return dotid
+	return kindID(dg.kind, dg.DotOptions.Edges)
+}
+
+// kindID returns the id of the subgraph of the kind: its name in names, or its printed form.
+func kindID(kind EdgeKind, names map[EdgeKind]string) string {
+	if name, has := names[kind]; has {
+		return name
 	}
-	return dotid
+	return fmt.Sprintf("%v", kind)
 }
 
 func (dg dotGraph) edgeLabel() string {
@@ -214,18 +232,35 @@ func (dg dotGraph) edgeColor() string {
 }
 
 func (dg dotGraph) DOTAttributers() (graph, node, edge encoding.Attributer) {
-	graph = attributes{}
+	if dg.cluster != "" {
+		return attributes{"label": dg.cluster}, attributes{}, attributes{}
+	}
+	// The graph has the attributes of the graph, and each subgraph the descriptor of its kind.
+	graph = dotAttributes(dg.xg.Attributes())
+	if dg.kind != nil {
+		graph = dg.descriptor()
+	}
 	node = attributes{"shape": string(dg.DotOptions.NodeShape)}
 	edge = attributes{"color": dg.edgeColor(), "label": dg.edgeLabel()}
 	return
 }
 
+// descriptor returns the descriptor of the kind of the subgraph as attributes.
+func (dg dotGraph) descriptor() attributes {
+	desc, _ := dg.xg.Descriptor(dg.kind)
+	attr := dotAttributes(attributeMap(desc.Attributes))
+	if desc.Description != "" {
+		attr[descriptionKey] = desc.Description
+	}
+	return attr
+}
+
 func (dg *dotGraph) Structure() []dot.Graph {
-	if dg.kind != nil {
+	if dg.kind != nil || dg.cluster != "" {
 		return nil
 	}
 
-	subs := []dot.Graph{}
+	subs := dg.clusters()
 	for k := range dg.xg.directed {
 		subs = append(subs,
 			&dotGraph{
@@ -238,6 +273,38 @@ func (dg *dotGraph) Structure() []dot.Graph {
 	return subs
 }
 
+// clusters returns a subgraph of the nodes of each cluster, in order of the labels.
+func (dg *dotGraph) clusters() []dot.Graph {
+	members := map[string]*simple.DirectedGraph{}
+	labels := []string{}
+	for n, label := range dg.DotOptions.Clusters {
+		gn := dg.xg.gonum(n)
+		if gn[0] == nil {
+			continue
+		}
+		cluster, has := members[label]
+		if !has {
+			cluster = simple.NewDirectedGraph()
+			members[label] = cluster
+			labels = append(labels, label)
+		}
+		cluster.AddNode(gn[0])
+	}
+	sort.Strings(labels)
+
+	subs := []dot.Graph{}
+	for _, label := range labels {
+		subs = append(subs,
+			&dotGraph{
+				cluster:    label,
+				DotOptions: dg.DotOptions,
+				Directed:   members[label],
+				xg:         dg.xg,
+			})
+	}
+	return subs
+}
+
 func EncodeDot(g Graph, options DotOptions) ([]byte, error) {
 	xg, is := g.(*graph)
 	if !is {
@@ -252,48 +319,202 @@ func EncodeDot(g Graph, options DotOptions) ([]byte, error) {
 	return dot.Marshal(dg, options.Name, options.Prefix, options.Indent)
 }
 
+// DecodeDot adds the nodes and edges of the dot file to the graph, the edges of the kind.
+// The graph attributes of the file set the attributes of the graph, and the attributes of
+// the subgraph of each kind its descriptor.  Nodes and edges the graph rejects, for example
+// edges closing a cycle of an acyclic kind, are reported by ErrDecode.
 func DecodeDot(buff []byte, g Graph, kind EdgeKind) error {
+	return DecodeDotWith(buff, g, kind, DotOptions{})
+}
+
+// DecodeDotWith is DecodeDot of a file encoded with the options.  The subgraphs are the kinds
+// named by options.Edges, the kind, and the kinds of the graph.
+func DecodeDotWith(buff []byte, g Graph, kind EdgeKind, options DotOptions) error {
 	// Check the implementation. Currently only support our own.
 	xg, is := g.(*graph)
 	if !is {
 		return fmt.Errorf("wrong implementation")
 	}
+	if xg.readOnly {
+		return ErrReadOnly{}
+	}
 
-	directed := xg.directedGraph(kind)
-	return dot.Unmarshal(buff,
-		&dotBuilder{
-			Graph:  directed,
-			xg:     xg,
-			kind:   kind,
-			nextID: &nodeID{},
-		})
+	file, err := dotformat.ParseBytes(buff)
+	if err != nil {
+		return err
+	}
+	if len(file.Graphs) != 1 {
+		return fmt.Errorf("invalid number of graphs; expected 1, got %d", len(file.Graphs))
+	}
+	src := file.Graphs[0]
+
+	kinds := []EdgeKind{}
+	for k := range options.Edges {
+		kinds = append(kinds, k)
+	}
+	sortKinds(kinds)
+	kinds = append(kinds, kind)
+	kinds = append(kinds, xg.kinds()...)
+	decodeMetadata(src, xg, func(id string) EdgeKind {
+		for _, k := range kinds {
+			if kindID(k, options.Edges) == id {
+				return k
+			}
+		}
+		return EdgeKind(id)
+	})
+
+	xg.directedGraph(kind)
+	d := &dotDecoder{xg: xg, kind: kind, nodes: map[string]*dotNode{}, nextID: &nodeID{}}
+	d.stmts(src.Stmts)
+	if len(d.errors) > 0 {
+		return ErrDecode{Errors: d.errors}
+	}
+	return nil
 }
 
-type dotBuilder struct {
-	gonum.Graph
-	kind   EdgeKind
+// decodeMetadata sets the attributes of the graph from the graph attributes of the dot graph,
+// and the descriptor of each kind from the attributes of its subgraph.  Values are strings.
+func decodeMetadata(src *ast.Graph, xg *graph, kindOf func(id string) EdgeKind) {
+	for _, attr := range graphAttrs(src.Stmts) {
+		xg.setAttribute(Attribute{Key: unquote(attr.Key), Value: unquote(attr.Val)})
+	}
+	for _, stmt := range src.Stmts {
+		sub, is := stmt.(*ast.Subgraph)
+		if !is || sub.ID == "" || strings.HasPrefix(unquote(sub.ID), "cluster_") {
+			continue
+		}
+		attrs := graphAttrs(sub.Stmts)
+		if len(attrs) == 0 {
+			continue
+		}
+		kind := kindOf(unquote(sub.ID))
+		desc, _ := xg.Descriptor(kind)
+		for _, attr := range attrs {
+			key, value := unquote(attr.Key), unquote(attr.Val)
+			if key == descriptionKey {
+				desc.Description = value
+				continue
+			}
+			desc.Attributes = setAttribute(desc.Attributes, Attribute{Key: key, Value: value})
+		}
+		xg.describe(kind, desc)
+	}
+}
+
+// graphAttrs returns the graph attributes among the statements: graph [k=v] and k=v.
+func graphAttrs(stmts []ast.Stmt) []*ast.Attr {
+	out := []*ast.Attr{}
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.Attr:
+			out = append(out, stmt)
+		case *ast.AttrStmt:
+			if stmt.Kind == ast.GraphKind {
+				out = append(out, stmt.Attrs...)
+			}
+		}
+	}
+	return out
+}
+
+// unquote unquotes an id of the dot file like the dot package, which leaves quoted HTML-like
+// strings as they are.
+func unquote(id string) string {
+	if len(id) >= 4 && strings.HasPrefix(id, `"<`) && strings.HasSuffix(id, `>"`) {
+		return id
+	}
+	if s, err := strconv.Unquote(id); err == nil {
+		return s
+	}
+	return id
+}
+
+// dotDecoder adds the nodes and the edges of the statements of a dot graph to the graph, the
+// edges of one kind.  The nodes of all the subgraphs are added, like dot.Unmarshal does.
+type dotDecoder struct {
 	xg     *graph
+	kind   EdgeKind
+	nodes  map[string]*dotNode
 	nextID *nodeID
+	errors []error // of the nodes and edges the graph rejects
+}
+
+// node returns the node of the id, added to the graph when first seen.
+func (d *dotDecoder) node(id string) *dotNode {
+	key := unquote(id)
+	if n, has := d.nodes[key]; has {
+		return n
+	}
+	n := &dotNode{key: NodeKey(key), id: d.nextID.get()}
+	d.nodes[key] = n
+	if err := d.xg.Add(n); err != nil {
+		d.errors = append(d.errors, err)
+	}
+	return n
+}
+
+// stmts adds the nodes and edges of the statements and returns the nodes they name.
+func (d *dotDecoder) stmts(stmts []ast.Stmt) []*dotNode {
+	named := []*dotNode{}
+	for _, stmt := range stmts {
+		switch stmt := stmt.(type) {
+		case *ast.NodeStmt:
+			n := d.node(stmt.Node.ID)
+			for _, attr := range stmt.Attrs {
+				n.SetAttribute(encoding.Attribute{Key: unquote(attr.Key), Value: unquote(attr.Val)})
+			}
+			named = append(named, n)
+		case *ast.EdgeStmt:
+			named = append(named, d.edges(stmt)...)
+		case *ast.Subgraph:
+			named = append(named, d.stmts(stmt.Stmts)...)
+		}
+	}
+	return named
 }
 
-func (b *dotBuilder) NewNode() gonum.Node {
-	return &dotNode{id: b.nextID.get()}
+// vertex returns the nodes of a node or of a subgraph.
+func (d *dotDecoder) vertex(v ast.Vertex) []*dotNode {
+	switch v := v.(type) {
+	case *ast.Node:
+		return []*dotNode{d.node(v.ID)}
+	case *ast.Subgraph:
+		return d.stmts(v.Stmts)
+	}
+	return nil
 }
 
-func (b *dotBuilder) AddNode(n gonum.Node) {
-	add, is := n.(*dotNode)
-	if !is {
-		return
+// edges associates the nodes of each vertex of the statement with those of the next one,
+// and returns the nodes of all the vertices.
+func (d *dotDecoder) edges(stmt *ast.EdgeStmt) []*dotNode {
+	attrs := []Attribute{}
+	for _, attr := range stmt.Attrs {
+		attrs = append(attrs, Attribute{Key: unquote(attr.Key), Value: unquote(attr.Val)})
+	}
+	from := d.vertex(stmt.From)
+	named := from
+	for to := stmt.To; to != nil; to = to.To {
+		next := d.vertex(to.Vertex)
+		for _, f := range from {
+			for _, t := range next {
+				if _, err := d.xg.Associate(f, d.kind, t, attrs...); err != nil {
+					d.errors = append(d.errors, err)
+				}
+			}
+		}
+		named = append(named, next...)
+		from = next
 	}
-	b.xg.Add(add)
-	return
+	return named
 }
 
 type dotEdge struct {
-	edge    *edge
+	edge    Edge
 	from    gonum.Node
 	to      gonum.Node
 	labeler EdgeLabeler
+	extra   map[string]string
 }
 
 func (e dotEdge) From() gonum.Node {
@@ -308,34 +529,20 @@ func (e dotEdge) ReversedEdge() gonum.Edge {
 	return &dotEdge{to: e.from, from: e.to}
 }
 
-func (e *dotEdge) SetAttribute(attr encoding.Attribute) error {
-	if e.edge == nil {
-		panic("cna't set")
-	}
-	if e.edge.attributes == nil {
-		e.edge.attributes = []Attribute{}
-	}
-	e.edge.attributes = append(e.edge.attributes,
-		Attribute{Key: attr.Key, Value: attr.Value})
-	return nil
-}
-
 func (e dotEdge) label() string {
 	if e.labeler != nil {
 		return e.labeler(e.edge)
 	}
 
-	if e.edge.attributes == nil {
-		return ""
-	}
-	for _, a := range e.edge.attributes {
+	attrs := edgeAttributes(e.edge)
+	for _, a := range attrs {
 		if a.Key == "label" {
 			return fmt.Sprintf("%v", a.Value)
 		}
 	}
 
 	labels := []string{}
-	for _, a := range e.edge.attributes {
+	for _, a := range attrs {
 		switch v := a.Value.(type) {
 		case func(Edge) string:
 			labels = append(labels, v(e.edge))
@@ -360,42 +567,8 @@ func (e dotEdge) Attributes() []encoding.Attribute {
 	if l := e.label(); l != "" {
 		attr["label"] = l
 	}
-	return attr.Attributes()
-}
-
-func (b *dotBuilder) NewEdge(from, to gonum.Node) gonum.Edge {
-	return &dotEdge{from: from, to: to}
-}
-
-func (b *dotBuilder) SetEdge(e gonum.Edge) {
-	ee, is := e.(*dotEdge)
-	if !is {
-		return
-	}
-	from, is := e.From().(*dotNode)
-	if !is {
-		return
-	}
-	to, is := e.To().(*dotNode)
-	if !is {
-		return
-	}
-	add, err := b.xg.Associate(from, b.kind, to)
-	if err == nil {
-		xedge, is := add.(*edge)
-		if is {
-			ee.edge = xedge
-		}
+	for k, v := range e.extra {
+		attr[k] = v
 	}
-	return
-}
-
-func (b *dotBuilder) DOTAttributeSetters() (G, N, E encoding.AttributeSetter) {
-	return attr("G"), attr("N"), attr("E")
-}
-
-type attr string
-
-func (a attr) SetAttribute(attr encoding.Attribute) error {
-	return nil
+	return attr.Attributes()
 }
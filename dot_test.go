@@ -344,3 +344,124 @@ func TestDotEdgeLabels(t *testing.T) {
 	}
 	require.Equal(t, label+","+label2, ed.label())
 }
+
+func TestDotMetadata(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+
+	calls := EdgeKind("calls")
+	g := Builder(Options{
+		Attributes: []Attribute{{Key: "name", Value: "services"}, {Key: "owner", Value: "web team"}},
+		Kinds: map[EdgeKind]KindDescriptor{
+			calls: {
+				Description: "A calls B",
+				Attributes:  []Attribute{{Key: "protocol", Value: "http"}},
+			},
+		},
+	})
+	require.NoError(t, g.Add(A, B))
+	_, err := g.Associate(A, calls, B)
+	require.NoError(t, err)
+
+	buff, err := EncodeDot(g, DotOptions{Name: "V", Indent: "  "})
+	require.NoError(t, err)
+	t.Log(string(buff))
+
+	decoded := Builder(Options{})
+	require.NoError(t, DecodeDot(buff, decoded, calls))
+
+	require.Equal(t, map[string]interface{}{"name": "services", "owner": "web team"}, decoded.Attributes())
+	desc, has := decoded.Descriptor(calls)
+	require.True(t, has)
+	require.Equal(t, KindDescriptor{
+		Description: "A calls B",
+		Attributes:  []Attribute{{Key: "protocol", Value: "http"}},
+	}, desc)
+	require.NotNil(t, decoded.Edge(decoded.Node("A"), calls, decoded.Node("B")))
+}
+
+func TestDotMetadataKinds(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+
+	likes, shares := EdgeKind(1), EdgeKind(2)
+	g := Builder(Options{
+		Kinds: map[EdgeKind]KindDescriptor{
+			likes:  {Description: "A likes B"},
+			shares: {Description: "A shares with B"},
+		},
+	})
+	require.NoError(t, g.Add(A, B, C))
+	g.Associate(A, likes, B, Attribute{Key: "since", Value: "2019"})
+	g.Associate(B, shares, C)
+
+	// Kinds that are not strings are found by the kind decoded
+	buff, err := EncodeDot(g, DotOptions{Name: "V"})
+	require.NoError(t, err)
+	t.Log(string(buff))
+
+	decoded := Builder(Options{})
+	require.NoError(t, DecodeDot(buff, decoded, likes))
+	desc, has := decoded.Descriptor(likes)
+	require.True(t, has)
+	require.Equal(t, "A likes B", desc.Description)
+	_, has = decoded.Descriptor(EdgeKind("1"))
+	require.False(t, has)
+	e := decoded.Edge(decoded.Node("A"), likes, decoded.Node("B"))
+	require.NotNil(t, e)
+	require.Equal(t, "2019", e.Attributes()["since"])
+
+	// and renamed kinds by the names they were encoded with
+	options := DotOptions{Name: "V", Edges: map[EdgeKind]string{likes: "likes", shares: "shares"}}
+	buff, err = EncodeDot(g, options)
+	require.NoError(t, err)
+
+	decoded = Builder(Options{})
+	require.NoError(t, DecodeDotWith(buff, decoded, likes, options))
+	desc, has = decoded.Descriptor(likes)
+	require.True(t, has)
+	require.Equal(t, "A likes B", desc.Description)
+	desc, has = decoded.Descriptor(shares)
+	require.True(t, has)
+	require.Equal(t, "A shares with B", desc.Description)
+	_, has = decoded.Descriptor(EdgeKind("likes"))
+	require.False(t, has)
+}
+
+func TestDecodeDotSubgraphs(t *testing.T) {
+
+	dot := `
+digraph G {
+  A [team=web];
+  A -> { B C } -> D [rate=2];
+  subgraph calls { E }
+}
+`
+	g := Builder(Options{})
+	calls := EdgeKind("calls")
+	require.NoError(t, DecodeDot([]byte(dot), g, calls))
+
+	for _, key := range []string{"A", "B", "C", "D", "E"} {
+		require.NotNil(t, g.Node(key))
+	}
+	require.Equal(t, "web", g.Node("A").(*dotNode).attributes["team"])
+	require.NotNil(t, g.Edge(g.Node("A"), calls, g.Node("B")))
+	require.NotNil(t, g.Edge(g.Node("A"), calls, g.Node("C")))
+	require.Equal(t, "2", g.Edge(g.Node("C"), calls, g.Node("D")).Attributes()["rate"])
+	require.Nil(t, g.Edge(g.Node("A"), calls, g.Node("D")))
+
+	require.Error(t, DecodeDot([]byte("digraph A {} digraph B {}"), Builder(Options{}), calls))
+
+	// Edges the graph rejects are reported, and the others added
+	acyclic := Builder(Options{Acyclic: []EdgeKind{calls}})
+	err := DecodeDot([]byte("digraph G { a -> b; b -> a; b -> c }"), acyclic, calls)
+	require.IsType(t, ErrDecode{}, err)
+	require.Equal(t, 1, len(err.(ErrDecode).Errors))
+	require.IsType(t, ErrCycle{}, err.(ErrDecode).Errors[0])
+	require.NotNil(t, acyclic.Edge(acyclic.Node("a"), calls, acyclic.Node("b")))
+	require.Nil(t, acyclic.Edge(acyclic.Node("b"), calls, acyclic.Node("a")))
+	require.NotNil(t, acyclic.Edge(acyclic.Node("b"), calls, acyclic.Node("c")))
+}
@@ -27,11 +27,7 @@ func (e *edge) Kind() EdgeKind {
 }
 
 func (e *edge) Attributes() map[string]interface{} {
-	m := map[string]interface{}{}
-	for _, a := range e.attributes {
-		m[a.Key] = a.Value
-	}
-	return m
+	return attributeMap(e.attributes)
 }
 
 func SortEdges(edges []Edge, less func(Edge, Edge) bool) {
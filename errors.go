@@ -2,6 +2,7 @@ package xgraph // import "github.com/orkestr8/xgraph"
 
 import (
 	"fmt"
+	"strings"
 )
 
 type ErrDuplicateKey struct {
@@ -21,6 +22,16 @@ func (e ErrNoSuchNode) Error() string {
 	return fmt.Sprintf("Missing %s node:%s", e.context, e.Node.NodeKey())
 }
 
+type ErrNoSuchEdge struct {
+	From Node
+	Kind EdgeKind
+	To   Node
+}
+
+func (e ErrNoSuchEdge) Error() string {
+	return fmt.Sprintf("Missing %v edge:%s -> %s", e.Kind, e.From.NodeKey(), e.To.NodeKey())
+}
+
 type ErrNotSupported struct {
 	Graph
 }
@@ -28,3 +39,164 @@ type ErrNotSupported struct {
 func (e ErrNotSupported) Error() string {
 	return fmt.Sprintf("Not supported: %v", e.Graph)
 }
+
+type ErrReadOnly struct {
+}
+
+func (e ErrReadOnly) Error() string {
+	return "Graph is a read only snapshot"
+}
+
+type ErrNotSettable struct {
+	Node
+}
+
+func (e ErrNotSettable) Error() string {
+	return fmt.Sprintf("Attributes cannot be set:%s", e.Node.NodeKey())
+}
+
+// ErrNodeType is returned for a node of a type the schema or a TypedBuilder does not allow.
+type ErrNodeType struct {
+	Node
+}
+
+func (e ErrNodeType) Error() string {
+	return fmt.Sprintf("Node type not allowed:%s", e.Node.NodeKey())
+}
+
+type ErrEndpointType struct {
+	Node
+	Kind    EdgeKind
+	context string
+}
+
+func (e ErrEndpointType) Error() string {
+	return fmt.Sprintf("Node type not allowed as %s of %v:%s", e.context, e.Kind, e.Node.NodeKey())
+}
+
+type ErrCardinality struct {
+	Node
+	Kind    EdgeKind
+	Limit   int
+	context string
+}
+
+func (e ErrCardinality) Error() string {
+	return fmt.Sprintf("More than %d %s edges of %v:%s", e.Limit, e.context, e.Kind, e.Node.NodeKey())
+}
+
+type ErrMissingAttribute struct {
+	Key  string
+	Kind EdgeKind
+	From Node
+	To   Node
+}
+
+func (e ErrMissingAttribute) Error() string {
+	return fmt.Sprintf("Missing attribute %s on %v edge:%s -> %s", e.Key, e.Kind, e.From.NodeKey(), e.To.NodeKey())
+}
+
+type ErrCycle struct {
+	Kind EdgeKind
+	Path
+}
+
+func (e ErrCycle) Error() string {
+	return fmt.Sprintf("Cycle in %v:%v", e.Kind, e.Path)
+}
+
+// ErrUnorderable is returned when the nodes of a kind cannot be sorted.  Components
+// are the strongly connected components that block the sort, and for each component,
+// Cycles has a cycle through its members.
+type ErrUnorderable struct {
+	Kind       EdgeKind
+	Components []Path
+	Cycles     []Path
+}
+
+func (e ErrUnorderable) Error() string {
+	cycles := make([]string, len(e.Cycles))
+	for i := range e.Cycles {
+		cycles[i] = e.Cycles[i].String()
+	}
+	return fmt.Sprintf("Cannot sort %v, cycles:%s", e.Kind, strings.Join(cycles, "; "))
+}
+
+type ErrNegativeWeight struct {
+	Edge
+}
+
+func (e ErrNegativeWeight) Error() string {
+	return fmt.Sprintf("Negative weight on %v edge:%s -> %s", e.Edge.Kind(), e.Edge.From().NodeKey(), e.Edge.To().NodeKey())
+}
+
+// ErrBatch is returned when a Batch is not applied, with the errors of the batch.
+type ErrBatch struct {
+	Errors []error
+}
+
+func (e ErrBatch) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i := range e.Errors {
+		messages[i] = e.Errors[i].Error()
+	}
+	return fmt.Sprintf("Batch failed:%s", strings.Join(messages, "; "))
+}
+
+// ErrDecode is returned when nodes or edges of a decoded file cannot be added to the graph,
+// with the errors of each.  The others are added.
+type ErrDecode struct {
+	Errors []error
+}
+
+func (e ErrDecode) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i := range e.Errors {
+		messages[i] = e.Errors[i].Error()
+	}
+	return fmt.Sprintf("Decode failed:%s", strings.Join(messages, "; "))
+}
+
+type ErrNoCodec struct {
+	Name string
+}
+
+func (e ErrNoCodec) Error() string {
+	return fmt.Sprintf("No node codec registered:%s", e.Name)
+}
+
+// ErrCorruptJournal is returned by Replay for a journal that cannot be read at an offset.
+type ErrCorruptJournal struct {
+	Offset int64
+	reason string
+}
+
+func (e ErrCorruptJournal) Error() string {
+	return fmt.Sprintf("Corrupt journal at %d:%s", e.Offset, e.reason)
+}
+
+type ErrNoVersion struct {
+	Version Version
+}
+
+func (e ErrNoVersion) Error() string {
+	return fmt.Sprintf("No such version:%d", e.Version)
+}
+
+// ErrKindNotEmpty is returned for a kind to be filled that already has edges.
+type ErrKindNotEmpty struct {
+	Kind EdgeKind
+}
+
+func (e ErrKindNotEmpty) Error() string {
+	return fmt.Sprintf("Kind has edges:%v", e.Kind)
+}
+
+// ErrKeyType is returned by TypedBuilder for a node whose key is not of the key type.
+type ErrKeyType struct {
+	Node
+}
+
+func (e ErrKeyType) Error() string {
+	return fmt.Sprintf("Key type not allowed:%v (%T)", e.Node.NodeKey(), e.Node.NodeKey())
+}
@@ -0,0 +1,239 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"sync"
+)
+
+// EventType is the type of change to a graph.
+type EventType int
+
+const (
+	// NodeAdded is sent for each node added by Add.
+	NodeAdded EventType = iota
+
+	// NodeRemoved is sent by Remove, after the edges of the node are disassociated.
+	NodeRemoved
+
+	// NodeChanged is sent by SetAttributes.
+	NodeChanged
+
+	// EdgeAssociated is sent when Associate adds an edge.
+	EdgeAssociated
+
+	// EdgeDisassociated is sent for each edge removed by Disassociate or Remove.
+	EdgeDisassociated
+
+	// EdgeChanged is sent when Associate replaces an edge.
+	EdgeChanged
+)
+
+func (t EventType) String() string {
+	switch t {
+	case NodeAdded:
+		return "NodeAdded"
+	case NodeRemoved:
+		return "NodeRemoved"
+	case NodeChanged:
+		return "NodeChanged"
+	case EdgeAssociated:
+		return "EdgeAssociated"
+	case EdgeDisassociated:
+		return "EdgeDisassociated"
+	case EdgeChanged:
+		return "EdgeChanged"
+	}
+	return "Unknown"
+}
+
+// Event is a change to a graph.  Node is set for node events and Edge for edge events.
+// Old is the replaced edge of EdgeChanged, and Attributes the attributes set by NodeChanged.
+// Sequence numbers the events of a graph from 1 in the order the changes were made.
+// Dropped is the number of events dropped for the observer before this one because its
+// queue was full (see Options.EventQueue).
+type Event struct {
+	Type       EventType
+	Sequence   uint64
+	Node       Node
+	Edge       Edge
+	Old        Edge
+	Attributes []Attribute
+	Dropped    uint64
+}
+
+// Observer is notified of the changes to a graph.
+type Observer interface {
+	Observe(Event)
+}
+
+// ObserverFunc is a function that is an Observer.
+type ObserverFunc func(Event)
+
+// Observe calls the function.
+func (f ObserverFunc) Observe(e Event) {
+	f(e)
+}
+
+// Subscribe adds an observer of the changes to the graph and returns the function that
+// removes it.  Each observer is called in its own goroutine with one event at a time, in
+// order, after the change is made, so it may read the graph.  Events are queued while the
+// observer is busy, up to Options.EventQueue, and dropped above it; changes never wait for
+// observers.  The changes of a Batch are sent only when it succeeds.  The goroutine of the
+// observer runs until cancel is called.
+func (g *graph) Subscribe(o Observer) (cancel func()) {
+	return g.observers.subscribe(o, g.EventQueue)
+}
+
+// Events subscribes to the changes to the graph and returns them on a channel, with the
+// function that stops them and closes the channel.
+func Events(g GraphBuilder) (<-chan Event, func()) {
+	events := make(chan Event)
+	done := make(chan struct{})
+	closed := false
+	var lock sync.Mutex
+
+	unsubscribe := g.Subscribe(ObserverFunc(func(e Event) {
+		lock.Lock()
+		defer lock.Unlock()
+		if closed {
+			return
+		}
+		select {
+		case events <- e:
+		case <-done:
+		}
+	}))
+
+	var once sync.Once
+	return events, func() {
+		once.Do(func() {
+			unsubscribe()
+			close(done)
+			lock.Lock()
+			defer lock.Unlock()
+			closed = true
+			close(events)
+		})
+	}
+}
+
+// emit sends the event to the observers of the graph, or holds it for the end of the batch.
+// The caller holds the lock that orders the change with the other changes.
+func (g *graph) emit(e Event) {
+	if g.batch != nil {
+		g.batch.lock.Lock()
+		defer g.batch.lock.Unlock()
+		g.batch.events = append(g.batch.events, e)
+		return
+	}
+	g.observers.publish(e)
+}
+
+type observers struct {
+	sequence    uint64
+	subscribers map[*subscriber]bool
+	history     *history     // kept only for versioned graphs
+	pasts       []*pastGraph // built by AsOf from the history
+	lock        sync.Mutex
+}
+
+func newObservers(versioned bool) *observers {
+	o := &observers{subscribers: map[*subscriber]bool{}}
+	if versioned {
+		o.history = newHistory()
+	}
+	return o
+}
+
+// subscribe adds the observer with a queue of at most limit events, or no limit if 0.
+func (o *observers) subscribe(observer Observer, limit int) func() {
+	s := &subscriber{
+		observer: observer,
+		limit:    limit,
+		wake:     make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	o.lock.Lock()
+	o.subscribers[s] = true
+	o.lock.Unlock()
+	go s.run()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			o.lock.Lock()
+			delete(o.subscribers, s)
+			o.lock.Unlock()
+			close(s.done)
+		})
+	}
+}
+
+func (o *observers) publish(e Event) {
+	o.lock.Lock()
+	defer o.lock.Unlock()
+
+	o.sequence++
+	e.Sequence = o.sequence
+	if o.history != nil {
+		o.history = o.history.owned()
+		o.history.record(e)
+	}
+	for s := range o.subscribers {
+		s.push(e)
+	}
+}
+
+// subscriber queues the events for an observer and delivers them in its goroutine.
+type subscriber struct {
+	observer Observer
+	queue    []Event
+	limit    int
+	dropped  uint64
+	wake     chan struct{}
+	done     chan struct{}
+	lock     sync.Mutex
+}
+
+func (s *subscriber) push(e Event) {
+	s.lock.Lock()
+	if s.limit > 0 && len(s.queue) >= s.limit {
+		s.dropped++
+		s.lock.Unlock()
+		return
+	}
+	e.Dropped, s.dropped = s.dropped, 0
+	s.queue = append(s.queue, e)
+	s.lock.Unlock()
+
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (s *subscriber) run() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.wake:
+		}
+		for {
+			s.lock.Lock()
+			if len(s.queue) == 0 {
+				s.lock.Unlock()
+				break
+			}
+			e := s.queue[0]
+			s.queue = s.queue[1:]
+			s.lock.Unlock()
+
+			select {
+			case <-s.done:
+				return
+			default:
+			}
+			s.observer.Observe(e)
+		}
+	}
+}
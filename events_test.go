@@ -0,0 +1,127 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func collect(events <-chan Event, n int) []string {
+	out := []string{}
+	for i := 0; i < n; i++ {
+		e := <-events
+		switch {
+		case e.Node != nil:
+			out = append(out, fmt.Sprintf("%d %v %v", e.Sequence, e.Type, e.Node.NodeKey()))
+		default:
+			out = append(out, fmt.Sprintf("%d %v %v", e.Sequence, e.Type, Path{e.Edge.From(), e.Edge.To()}))
+		}
+	}
+	return out
+}
+
+func TestEvents(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+
+	g := Builder(Options{})
+	events, cancel := Events(g)
+
+	calls := EdgeKind("calls")
+	require.NoError(t, g.Add(A, B, C))
+	g.Associate(A, calls, B)
+	g.Associate(B, calls, C)
+	g.Associate(A, calls, B, Attribute{Key: "rate", Value: 2})
+	require.NoError(t, SetAttributes(g, C, Attribute{Key: "team", Value: "web"}))
+	require.NoError(t, g.Disassociate(A, calls, B))
+	require.NoError(t, g.Remove(B))
+
+	require.Equal(t, []string{
+		"1 NodeAdded A",
+		"2 NodeAdded B",
+		"3 NodeAdded C",
+		"4 EdgeAssociated A -> B",
+		"5 EdgeAssociated B -> C",
+		"6 EdgeChanged A -> B",
+		"7 NodeChanged C",
+		"8 EdgeDisassociated A -> B",
+		"9 EdgeDisassociated B -> C",
+		"10 NodeRemoved B",
+	}, collect(events, 10))
+
+	cancel()
+	cancel()
+	_, open := <-events
+	require.False(t, open)
+}
+
+func TestEventsBatch(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+
+	g := Builder(Options{})
+	received := make(chan Event, 10)
+	cancel := g.Subscribe(ObserverFunc(func(e Event) { received <- e }))
+	defer cancel()
+
+	// A failed batch sends nothing
+	err := g.Batch(func(tx GraphBuilder) error {
+		tx.Add(A)
+		return errors.New("boom")
+	})
+	require.Error(t, err)
+
+	err = g.Batch(func(tx GraphBuilder) error {
+		tx.Add(A, B)
+		tx.Associate(A, EdgeKind("calls"), B)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []string{
+		"1 NodeAdded A",
+		"2 NodeAdded B",
+		"3 EdgeAssociated A -> B",
+	}, collect(received, 3))
+
+	// Clones have their own observers
+	clone, err := Clone(g)
+	require.NoError(t, err)
+	require.NoError(t, clone.Add(&nodeT{id: "C"}))
+	require.NoError(t, g.Add(&nodeT{id: "D"}))
+	require.Equal(t, []string{"4 NodeAdded D"}, collect(received, 1))
+}
+
+func TestEventQueue(t *testing.T) {
+
+	g := Builder(Options{EventQueue: 2})
+	received := make(chan Event, 10)
+	busy := make(chan struct{})
+	cancel := g.Subscribe(ObserverFunc(func(e Event) {
+		received <- e
+		if e.Sequence == 1 {
+			<-busy
+		}
+	}))
+	defer cancel()
+
+	require.NoError(t, g.Add(&nodeT{id: "A"}))
+	require.Equal(t, uint64(1), (<-received).Sequence)
+
+	// The observer is busy: two events are queued and the others dropped
+	for _, id := range []string{"B", "C", "D", "E"} {
+		require.NoError(t, g.Add(&nodeT{id: id}))
+	}
+	close(busy)
+	require.Equal(t, uint64(2), (<-received).Sequence)
+	require.Equal(t, uint64(3), (<-received).Sequence)
+
+	require.NoError(t, g.Add(&nodeT{id: "F"}))
+	e := <-received
+	require.Equal(t, uint64(6), e.Sequence)
+	require.Equal(t, uint64(2), e.Dropped)
+}
@@ -0,0 +1,284 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"container/heap"
+	"math"
+	"sort"
+
+	gonum "gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/topo"
+)
+
+// FeedbackArcSetOptions control FeedbackArcSet.
+type FeedbackArcSetOptions struct {
+
+	// Weight is the cost of removing an edge.  Every edge costs 1 if nil.
+	Weight EdgeWeightFunc
+
+	// ExactLimit is the size of the largest strongly connected component that is solved
+	// exactly.  Larger components use the greedy heuristic of Eades, Lin and Smyth.
+	// Defaults to 16.
+	ExactLimit int
+}
+
+const defaultExactLimit = 16
+
+// FeedbackArcSet returns edges of the kind whose removal makes the kind acyclic, trying
+// to minimize the total weight of the edges removed.  Only edges within strongly connected
+// components can be part of a cycle, so each component is solved separately.  Components
+// of up to ExactLimit nodes are solved exactly; the result for larger components is an
+// approximation.
+func FeedbackArcSet(g Graph, kind EdgeKind, options FeedbackArcSetOptions) (arcs EdgeSlice, err error) {
+	arcs = EdgeSlice{}
+	err = scopeDirected(g, kind,
+
+		func(dg *directed) error {
+			dg.lock.RLock()
+			defer dg.lock.RUnlock()
+
+			arcs = dg.feedbackArcSet(options)
+			return nil
+		})
+	return
+}
+
+func (d *directed) feedbackArcSet(options FeedbackArcSetOptions) EdgeSlice {
+	weight := options.Weight
+	if weight == nil {
+		weight = unitWeight
+	}
+	limit := options.ExactLimit
+	if limit <= 0 {
+		limit = defaultExactLimit
+	}
+
+	type arc struct {
+		order indexOrder
+		edge  Edge
+	}
+	arcs := []arc{}
+
+	for _, scc := range topo.TarjanSCC(d) {
+		if len(scc) < 2 {
+			continue
+		}
+		sortNodesByID(scc)
+
+		c := d.component(scc, weight)
+		var order []int
+		if len(scc) <= limit {
+			order = c.exactOrder()
+		} else {
+			order = c.greedyOrder()
+		}
+
+		// Edges pointing backwards in the order are the ones to remove.
+		position := make([]int, len(order))
+		for i, v := range order {
+			position[v] = i
+		}
+		for u := range c.out {
+			for _, a := range c.out[u] {
+				if position[a.to] < position[u] {
+					from, to := scc[u].ID(), scc[a.to].ID()
+					arcs = append(arcs, arc{order: indexOrder{from, to}, edge: d.edge(from, to)})
+				}
+			}
+		}
+	}
+
+	sort.Slice(arcs, func(i, j int) bool { return arcs[i].order.less(arcs[j].order) })
+	out := make(EdgeSlice, len(arcs))
+	for i := range arcs {
+		out[i] = arcs[i].edge
+	}
+	return out
+}
+
+type weightedArc struct {
+	to     int
+	weight float64
+}
+
+// component is a strongly connected component with the nodes numbered 0..n-1 in the order
+// of the given nodes.
+type component struct {
+	out [][]weightedArc
+	in  [][]weightedArc
+}
+
+func (d *directed) component(nodes []gonum.Node, weight EdgeWeightFunc) *component {
+	index := map[int64]int{}
+	for i, n := range nodes {
+		index[n.ID()] = i
+	}
+	c := &component{
+		out: make([][]weightedArc, len(nodes)),
+		in:  make([][]weightedArc, len(nodes)),
+	}
+	for i, n := range nodes {
+		for _, next := range sortNodesByID(gonum.NodesOf(d.From(n.ID()))) {
+			j, in := index[next.ID()]
+			if !in {
+				continue
+			}
+			w := weight(d.edge(n.ID(), next.ID()))
+			c.out[i] = append(c.out[i], weightedArc{to: j, weight: w})
+			c.in[j] = append(c.in[j], weightedArc{to: i, weight: w})
+		}
+	}
+	return c
+}
+
+// exactOrder finds the order of the nodes with the minimum total weight of backward edges
+// by dynamic programming over the subsets of nodes placed first.
+func (c *component) exactOrder() []int {
+	n := len(c.out)
+	full := 1 << uint(n)
+	cost := make([]float64, full)
+	last := make([]int, full)
+
+	for set := 1; set < full; set++ {
+		cost[set] = math.Inf(1)
+		for v := 0; v < n; v++ {
+			bit := 1 << uint(v)
+			if set&bit == 0 {
+				continue
+			}
+			before := set &^ bit
+			// Placing v after the nodes in before makes its edges to them backward edges.
+			c0 := cost[before]
+			for _, a := range c.out[v] {
+				if before&(1<<uint(a.to)) != 0 {
+					c0 += a.weight
+				}
+			}
+			if c0 < cost[set] {
+				cost[set] = c0
+				last[set] = v
+			}
+		}
+	}
+
+	order := make([]int, n)
+	for set, i := full-1, n-1; set > 0; i-- {
+		order[i] = last[set]
+		set &^= 1 << uint(last[set])
+	}
+	return order
+}
+
+// greedyOrder orders the nodes with the heuristic of Eades, Lin and Smyth, "A fast and
+// effective heuristic for the feedback arc set problem", weighted: sinks go to the end,
+// sources to the front, and otherwise the node with the largest difference of outgoing
+// and incoming weight goes to the front.
+func (c *component) greedyOrder() []int {
+	n := len(c.out)
+	removed := make([]bool, n)
+	outDegree := make([]int, n)
+	inDegree := make([]int, n)
+	delta := make([]float64, n)
+	for v := 0; v < n; v++ {
+		outDegree[v] = len(c.out[v])
+		inDegree[v] = len(c.in[v])
+		for _, a := range c.out[v] {
+			delta[v] += a.weight
+		}
+		for _, a := range c.in[v] {
+			delta[v] -= a.weight
+		}
+	}
+
+	front, back := []int{}, []int{}
+	sinks, sources := []int{}, []int{}
+	candidates := &deltaHeap{}
+	for v := 0; v < n; v++ {
+		heap.Push(candidates, deltaEntry{node: v, delta: delta[v]})
+	}
+
+	remove := func(v int) {
+		removed[v] = true
+		for _, a := range c.out[v] {
+			if removed[a.to] {
+				continue
+			}
+			inDegree[a.to]--
+			delta[a.to] += a.weight
+			heap.Push(candidates, deltaEntry{node: a.to, delta: delta[a.to]})
+			if inDegree[a.to] == 0 {
+				sources = append(sources, a.to)
+			}
+		}
+		for _, a := range c.in[v] {
+			if removed[a.to] {
+				continue
+			}
+			outDegree[a.to]--
+			delta[a.to] -= a.weight
+			heap.Push(candidates, deltaEntry{node: a.to, delta: delta[a.to]})
+			if outDegree[a.to] == 0 {
+				sinks = append(sinks, a.to)
+			}
+		}
+	}
+
+	for placed := 0; placed < n; {
+		var v int
+		switch {
+		case len(sinks) > 0:
+			v, sinks = sinks[0], sinks[1:]
+			if removed[v] {
+				continue
+			}
+			back = append(back, v)
+		case len(sources) > 0:
+			v, sources = sources[0], sources[1:]
+			if removed[v] {
+				continue
+			}
+			front = append(front, v)
+		default:
+			entry := heap.Pop(candidates).(deltaEntry)
+			v = entry.node
+			if removed[v] || entry.delta != delta[v] {
+				continue // stale entry
+			}
+			front = append(front, v)
+		}
+		remove(v)
+		placed++
+	}
+
+	for i := len(back) - 1; i >= 0; i-- {
+		front = append(front, back[i])
+	}
+	return front
+}
+
+type deltaEntry struct {
+	node  int
+	delta float64
+}
+
+// deltaHeap is a max heap by delta, ties broken by the lower node number.
+type deltaHeap []deltaEntry
+
+func (h deltaHeap) Len() int { return len(h) }
+
+func (h deltaHeap) Less(i, j int) bool {
+	if h[i].delta != h[j].delta {
+		return h[i].delta > h[j].delta
+	}
+	return h[i].node < h[j].node
+}
+
+func (h deltaHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *deltaHeap) Push(x interface{}) { *h = append(*h, x.(deltaEntry)) }
+
+func (h *deltaHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
@@ -0,0 +1,137 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// withoutEdges copies the kind of a graph minus the given edges.
+func withoutEdges(t *testing.T, g Graph, kind EdgeKind, nodes []Node, remove EdgeSlice) GraphBuilder {
+	removed := map[Edge]bool{}
+	for _, e := range remove {
+		removed[e] = true
+	}
+	out := Builder(Options{})
+	require.NoError(t, out.Add(nodes[0], nodes[1:]...))
+	for _, n := range nodes {
+		for _, e := range g.From(n, kind).Edges().Slice() {
+			if !removed[e] {
+				_, err := out.Associate(e.From(), kind, e.To())
+				require.NoError(t, err)
+			}
+		}
+	}
+	return out
+}
+
+func TestFeedbackArcSet(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	D := &nodeT{id: "D"}
+	E := &nodeT{id: "E"}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(A, B, C, D, E))
+
+	calls := EdgeKind("calls")
+	cost := func(v int) Attribute { return Attribute{Key: "cost", Value: v} }
+
+	g.Associate(A, calls, B, cost(1))
+	g.Associate(B, calls, C, cost(5))
+	g.Associate(C, calls, A, cost(5))
+	g.Associate(C, calls, D, cost(1))
+	g.Associate(D, calls, E, cost(1))
+	g.Associate(E, calls, D, cost(3))
+
+	arcs, err := FeedbackArcSet(g, calls, FeedbackArcSetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(arcs))
+
+	arcs, err = FeedbackArcSet(g, calls, FeedbackArcSetOptions{Weight: EdgeAttributeWeight("cost", 1)})
+	require.NoError(t, err)
+	require.Equal(t, EdgeSlice{g.Edge(A, calls, B), g.Edge(D, calls, E)}, arcs)
+
+	arcs, err = FeedbackArcSet(g, EdgeKind("none"), FeedbackArcSetOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 0, len(arcs))
+
+	_, err = FeedbackArcSet(nil, calls, FeedbackArcSetOptions{})
+	require.Error(t, err)
+}
+
+func TestFeedbackArcSetExactAndGreedy(t *testing.T) {
+
+	kind := EdgeKind(1)
+
+	for seed := int64(0); seed < 10; seed++ {
+		r := rand.New(rand.NewSource(seed))
+
+		g := Builder(Options{})
+		nodes := []Node{}
+		for i := 0; i < 10; i++ {
+			nodes = append(nodes, &nodeT{id: fmt.Sprintf("N%d", i)})
+		}
+		require.NoError(t, g.Add(nodes[0], nodes[1:]...))
+		for i := 0; i < 30; i++ {
+			from, to := r.Intn(len(nodes)), r.Intn(len(nodes))
+			if from != to {
+				g.Associate(nodes[from], kind, nodes[to], Attribute{Key: "w", Value: r.Intn(10)})
+			}
+		}
+
+		weight := EdgeAttributeWeight("w", 1)
+		total := func(arcs EdgeSlice) (sum float64) {
+			for _, e := range arcs {
+				sum += weight(e)
+			}
+			return
+		}
+
+		exact, err := FeedbackArcSet(g, kind, FeedbackArcSetOptions{Weight: weight})
+		require.NoError(t, err)
+		greedy, err := FeedbackArcSet(g, kind, FeedbackArcSetOptions{Weight: weight, ExactLimit: 1})
+		require.NoError(t, err)
+
+		require.True(t, total(exact) <= total(greedy))
+
+		for _, arcs := range []EdgeSlice{exact, greedy} {
+			_, err = DirectedSort(withoutEdges(t, g, kind, nodes, arcs), kind)
+			require.NoError(t, err)
+
+			cycles, err := DirectedCycles(withoutEdges(t, g, kind, nodes, arcs), kind)
+			require.NoError(t, err)
+			require.Equal(t, 0, len(cycles))
+		}
+	}
+}
+
+func TestFeedbackArcSetLarge(t *testing.T) {
+
+	kind := EdgeKind(1)
+	r := rand.New(rand.NewSource(1))
+
+	g := Builder(Options{})
+	nodes := []Node{}
+	for i := 0; i < 2000; i++ {
+		nodes = append(nodes, &nodeT{id: fmt.Sprintf("N%d", i)})
+	}
+	require.NoError(t, g.Add(nodes[0], nodes[1:]...))
+	for i := 0; i < 10000; i++ {
+		from, to := r.Intn(len(nodes)), r.Intn(len(nodes))
+		if from != to {
+			g.Associate(nodes[from], kind, nodes[to])
+		}
+	}
+
+	arcs, err := FeedbackArcSet(g, kind, FeedbackArcSetOptions{})
+	require.NoError(t, err)
+	require.True(t, len(arcs) > 0)
+
+	_, err = DirectedSort(withoutEdges(t, g, kind, nodes, arcs), kind)
+	require.NoError(t, err)
+}
@@ -5,7 +5,7 @@ import (
 )
 
 func NewExecutor(ref GraphRef, g xg.Graph, kind xg.EdgeKind, options Options) (Executor, error) {
-	ordered, err := xg.DirectedSort(g, kind)
+	ordered, err := xg.DirectedSortStable(g, kind, orderNodeByKey)
 	if err != nil {
 		return nil, err
 	}
@@ -24,7 +24,7 @@ func NewFlowGraph(g xg.Graph, kind xg.EdgeKind) (*FlowGraph, error) {
 		output:     map[xg.Node]chan work{},
 		aggregator: make(chan work),
 	}
-	ordered, err := xg.DirectedSort(g, kind)
+	ordered, err := xg.DirectedSortStable(g, kind, orderNodeByKey)
 	if err != nil {
 		return nil, err
 	}
@@ -19,6 +19,21 @@ func TestFlowNew(t *testing.T) {
 	require.NoError(t, executor.Close())
 }
 
+func TestFlowNewCyclic(t *testing.T) {
+	ref := GraphRef("test")
+	kind := xg.EdgeKind(1)
+	gg := testBuildGraph(kind)
+
+	ratio := gg.Node(xg.NodeKey("ratio"))
+	x1 := gg.Node(xg.NodeKey("x1"))
+	_, err := gg.(xg.GraphBuilder).Associate(ratio, kind, x1)
+	require.NoError(t, err)
+
+	_, err = NewExecutor(ref, gg, kind, Options{})
+	require.Error(t, err)
+	require.Equal(t, "Cannot sort 1, cycles:x1 -> sumX -> ratio -> x1", err.Error())
+}
+
 func TestFlowExecFull(t *testing.T) {
 	ref := GraphRef("test")
 	kind := xg.EdgeKind(1)
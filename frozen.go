@@ -0,0 +1,370 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"container/heap"
+	"sort"
+)
+
+// Frozen is an immutable graph for reading large graphs fast.  Nodes are numbered from 0 in
+// the order they were added, and the edges of each kind are kept in compressed sparse row
+// form: the edges from a node are a range of one array, ordered by the number of the node
+// they go to.  Edges are values made on demand and compare equal when they are the same.
+// Nodes keep the attributes the graph had for them, which NodeAttributes returns.  Besides
+// its methods, a Frozen graph is supported by DirectedSort and NodeAttributes only: the
+// other functions of the package return ErrNotSupported for it.
+type Frozen struct {
+	nodes       []Node
+	nodeAttrs   []map[string]interface{} // of each node in nodes
+	index       map[interface{}]int32
+	kinds       map[EdgeKind]*csr
+	attributes  []Attribute
+	descriptors map[EdgeKind]KindDescriptor
+}
+
+// csr is the compressed sparse row form of the edges of a kind.  The edges from node i are
+// at out[offsets[i]:offsets[i+1]], and the edges to node i at in[inOffsets[i]:inOffsets[i+1]]
+// as positions in out.
+type csr struct {
+	kind       EdgeKind
+	offsets    []int32
+	out        []int32
+	attributes [][]Attribute // of each edge in out
+	inOffsets  []int32
+	in         []int32
+	sources    []int32 // the node each edge in out is from
+	members    []bool  // the nodes of the kind, including those without edges now
+}
+
+// Freeze builds the frozen form of the graph as it is now.
+func Freeze(g Graph) (*Frozen, error) {
+	xg, ok := g.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{g}
+	}
+
+	xg.lock.RLock()
+	state := xg.state()
+	attributes, descriptors := xg.Options.Attributes, xg.Options.Kinds
+	members := map[EdgeKind][]NodeKey{}
+	for kind, d := range xg.directed {
+		d.lock.RLock()
+		for _, n := range d.sortedNodes() {
+			members[kind] = append(members[kind], n.(*node).NodeKey())
+		}
+		d.lock.RUnlock()
+	}
+	xg.lock.RUnlock()
+
+	f := &Frozen{
+		nodes:       make([]Node, len(state.nodes)),
+		nodeAttrs:   make([]map[string]interface{}, len(state.nodes)),
+		index:       make(map[interface{}]int32, len(state.nodes)),
+		kinds:       map[EdgeKind]*csr{},
+		attributes:  attributes,
+		descriptors: descriptors,
+	}
+	for i, n := range state.nodes {
+		f.nodes[i] = n.Node
+		f.nodeAttrs[i] = n.attributes
+		f.index[n.NodeKey()] = int32(i)
+	}
+
+	// The edges of the state are ordered by kind, then by the from and to nodes.
+	byKind := map[EdgeKind][]*edge{}
+	for _, e := range state.edges {
+		byKind[e.kind] = append(byKind[e.kind], e)
+	}
+	for kind, keys := range members {
+		f.kinds[kind] = f.compress(kind, keys, byKind[kind])
+	}
+	return f, nil
+}
+
+func (f *Frozen) compress(kind EdgeKind, members []NodeKey, edges []*edge) *csr {
+	n := len(f.nodes)
+	c := &csr{
+		kind:       kind,
+		offsets:    make([]int32, n+1),
+		out:        make([]int32, len(edges)),
+		attributes: make([][]Attribute, len(edges)),
+		inOffsets:  make([]int32, n+1),
+		in:         make([]int32, len(edges)),
+		sources:    make([]int32, len(edges)),
+		members:    make([]bool, n),
+	}
+	for _, key := range members {
+		c.members[f.index[key]] = true
+	}
+	for i, e := range edges {
+		from, to := f.index[e.from.NodeKey()], f.index[e.to.NodeKey()]
+		c.offsets[from+1]++
+		c.inOffsets[to+1]++
+		c.out[i] = to
+		c.sources[i] = from
+		c.attributes[i] = e.attributes
+	}
+	for i := 0; i < n; i++ {
+		c.offsets[i+1] += c.offsets[i]
+		c.inOffsets[i+1] += c.inOffsets[i]
+	}
+	next := append([]int32{}, c.inOffsets[:n]...)
+	for i := range edges {
+		to := c.out[i]
+		c.in[next[to]] = int32(i)
+		next[to]++
+	}
+	return c
+}
+
+// frozenEdge is an edge of a Frozen graph, by its position in the csr.
+type frozenEdge struct {
+	f   *Frozen
+	csr *csr
+	pos int32
+}
+
+func (e frozenEdge) Kind() EdgeKind {
+	return e.csr.kind
+}
+
+func (e frozenEdge) From() Node {
+	return e.f.nodes[e.csr.sources[e.pos]]
+}
+
+func (e frozenEdge) To() Node {
+	return e.f.nodes[e.csr.out[e.pos]]
+}
+
+func (e frozenEdge) Attributes() map[string]interface{} {
+	return attributeMap(e.csr.attributes[e.pos])
+}
+
+// Len returns the number of nodes.
+func (f *Frozen) Len() int {
+	return len(f.nodes)
+}
+
+// Kinds returns the edge kinds ordered by their printed form.
+func (f *Frozen) Kinds() []EdgeKind {
+	kinds := make([]EdgeKind, 0, len(f.kinds))
+	for kind := range f.kinds {
+		kinds = append(kinds, kind)
+	}
+	sortKinds(kinds)
+	return kinds
+}
+
+// Attributes returns the attributes of the graph when it was frozen.
+func (f *Frozen) Attributes() map[string]interface{} {
+	return attributeMap(f.attributes)
+}
+
+func (f *Frozen) Descriptor(kind EdgeKind) (KindDescriptor, bool) {
+	desc, has := f.descriptors[kind]
+	return desc, has
+}
+
+func (f *Frozen) Node(k NodeKey) Node {
+	if i, has := f.index[k]; has {
+		return f.nodes[i]
+	}
+	return nil
+}
+
+// ends returns the csr of the kind and the number of the node, or false.
+func (f *Frozen) ends(kind EdgeKind, n Node) (*csr, int32, bool) {
+	c, has := f.kinds[kind]
+	if !has {
+		return nil, 0, false
+	}
+	i, has := f.index[n.NodeKey()]
+	if !has || f.nodes[i] != n {
+		return nil, 0, false
+	}
+	return c, i, true
+}
+
+func (f *Frozen) Edge(from Node, kind EdgeKind, to Node) Edge {
+	c, i, ok := f.ends(kind, from)
+	if !ok {
+		return nil
+	}
+	j, has := f.index[to.NodeKey()]
+	if !has || f.nodes[j] != to {
+		return nil
+	}
+	out := c.out[c.offsets[i]:c.offsets[i+1]]
+	k := sort.Search(len(out), func(k int) bool { return out[k] >= j })
+	if k == len(out) || out[k] != j {
+		return nil
+	}
+	return frozenEdge{f: f, csr: c, pos: c.offsets[i] + int32(k)}
+}
+
+// Successors returns the nodes the edges of the kind from the node go to, in the order the
+// nodes were added.
+func (f *Frozen) Successors(n Node, kind EdgeKind) NodeSlice {
+	c, i, ok := f.ends(kind, n)
+	if !ok {
+		return NodeSlice{}
+	}
+	out := make(NodeSlice, 0, c.offsets[i+1]-c.offsets[i])
+	for _, j := range c.out[c.offsets[i]:c.offsets[i+1]] {
+		out = append(out, f.nodes[j])
+	}
+	return out
+}
+
+// Predecessors returns the nodes the edges of the kind to the node come from, in the order
+// the nodes were added.
+func (f *Frozen) Predecessors(kind EdgeKind, n Node) NodeSlice {
+	c, i, ok := f.ends(kind, n)
+	if !ok {
+		return NodeSlice{}
+	}
+	out := make(NodeSlice, 0, c.inOffsets[i+1]-c.inOffsets[i])
+	for _, pos := range c.in[c.inOffsets[i]:c.inOffsets[i+1]] {
+		out = append(out, f.nodes[c.sources[pos]])
+	}
+	return out
+}
+
+func (f *Frozen) From(from Node, kind EdgeKind) NodesOrEdges {
+	return f.query(kind, from, false)
+}
+
+func (f *Frozen) To(kind EdgeKind, to Node) NodesOrEdges {
+	return f.query(kind, to, true)
+}
+
+// query answers From and To on buffered channels filled up front, without goroutines.
+func (f *Frozen) query(kind EdgeKind, n Node, to bool) NodesOrEdges {
+	positions := func() (*csr, []int32) {
+		c, i, ok := f.ends(kind, n)
+		if !ok {
+			return nil, nil
+		}
+		if to {
+			return c, c.in[c.inOffsets[i]:c.inOffsets[i+1]]
+		}
+		all := make([]int32, 0, c.offsets[i+1]-c.offsets[i])
+		for pos := c.offsets[i]; pos < c.offsets[i+1]; pos++ {
+			all = append(all, pos)
+		}
+		return c, all
+	}
+	return &nodesOrEdges{
+		nodes: func(checks []func(Node) bool) Nodes {
+			c, all := positions()
+			ch := make(chan Node, len(all))
+			for _, pos := range all {
+				other := f.nodes[c.out[pos]]
+				if to {
+					other = f.nodes[c.sources[pos]]
+				}
+				if selected(checks, other) {
+					ch <- other
+				}
+			}
+			close(ch)
+			return ch
+		},
+		edges: func(checks []func(Edge) bool) Edges {
+			c, all := positions()
+			ch := make(chan Edge, len(all))
+			for _, pos := range all {
+				e := frozenEdge{f: f, csr: c, pos: pos}
+				if len(checks) == 0 {
+					ch <- e
+					continue
+				}
+				for _, check := range checks {
+					if check(e) {
+						ch <- e
+						break
+					}
+				}
+			}
+			close(ch)
+			return ch
+		},
+	}
+}
+
+// selected tells if any check matches the node, like the selectors of From and To.
+func selected(checks []func(Node) bool, n Node) bool {
+	if len(checks) == 0 {
+		return true
+	}
+	for _, check := range checks {
+		if check(n) {
+			return true
+		}
+	}
+	return false
+}
+
+// sort sorts the nodes of the kind topologically, the earliest added first among the ready
+// nodes, like DirectedSortStable.
+func (f *Frozen) sort(kind EdgeKind) ([]Node, error) {
+	c, has := f.kinds[kind]
+	if !has {
+		return nil, nil
+	}
+
+	// Like the graph, only the nodes of the kind are sorted.
+	inDegree := make([]int32, len(f.nodes))
+	ready := &indexHeap{}
+	total := 0
+	for i := range f.nodes {
+		if !c.members[i] {
+			continue
+		}
+		total++
+		inDegree[i] = c.inOffsets[i+1] - c.inOffsets[i]
+		if inDegree[i] == 0 {
+			heap.Push(ready, int32(i))
+		}
+	}
+
+	sorted := make([]Node, 0, total)
+	for ready.Len() > 0 {
+		i := heap.Pop(ready).(int32)
+		sorted = append(sorted, f.nodes[i])
+		for _, j := range c.out[c.offsets[i]:c.offsets[i+1]] {
+			inDegree[j]--
+			if inDegree[j] == 0 {
+				heap.Push(ready, j)
+			}
+		}
+	}
+	if len(sorted) < total {
+		return nil, f.thaw(kind).unsortable()
+	}
+	return sorted, nil
+}
+
+// thaw builds the graph of the kind, for the errors of the graph.
+func (f *Frozen) thaw(kind EdgeKind) *directed {
+	g := newGraph(Options{})
+	g.Add(f.nodes[0], f.nodes[1:]...)
+	c := f.kinds[kind]
+	for pos := range c.out {
+		g.Associate(f.nodes[c.sources[pos]], kind, f.nodes[c.out[pos]], c.attributes[pos]...)
+	}
+	return g.directed[kind]
+}
+
+// indexHeap is a min heap of node numbers.
+type indexHeap []int32
+
+func (h indexHeap) Len() int            { return len(h) }
+func (h indexHeap) Less(i, j int) bool  { return h[i] < h[j] }
+func (h indexHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *indexHeap) Push(x interface{}) { *h = append(*h, x.(int32)) }
+func (h *indexHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
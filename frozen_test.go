@@ -0,0 +1,196 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFreeze(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	D := &nodeT{id: "D"}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(A, B, C, D))
+	calls := EdgeKind("calls")
+	g.Associate(A, calls, C, Attribute{Key: "rate", Value: 2})
+	g.Associate(A, calls, B)
+	g.Associate(B, calls, C)
+	g.Associate(D, EdgeKind("owns"), A)
+
+	f, err := Freeze(g)
+	require.NoError(t, err)
+
+	// Changes after the freeze are not seen
+	g.Associate(C, calls, D)
+
+	require.Equal(t, 4, f.Len())
+	require.Equal(t, []EdgeKind{calls, EdgeKind("owns")}, f.Kinds())
+	require.Equal(t, B, f.Node("B"))
+	require.Nil(t, f.Node("E"))
+
+	e := f.Edge(A, calls, C)
+	require.NotNil(t, e)
+	require.Equal(t, e, f.Edge(A, calls, C))
+	require.Equal(t, A, e.From())
+	require.Equal(t, C, e.To())
+	require.Equal(t, calls, e.Kind())
+	require.Equal(t, 2, e.Attributes()["rate"])
+	require.Nil(t, f.Edge(C, calls, A))
+	require.Nil(t, f.Edge(C, calls, D))
+
+	require.Equal(t, NodeSlice{B, C}, f.Successors(A, calls))
+	require.Equal(t, NodeSlice{A, B}, f.Predecessors(calls, C))
+	require.Equal(t, NodeSlice{B, C}, f.From(A, calls).Nodes().Slice())
+	require.Equal(t, NodeSlice{A, B}, f.To(calls, C).Nodes().Slice())
+	require.Equal(t, NodeSlice{C}, f.From(A, calls).Nodes(func(n Node) bool { return n == C }).Slice())
+	require.Equal(t, 1, len(f.To(calls, B).Edges().Slice()))
+	require.Equal(t, 0, len(f.From(A, EdgeKind("none")).Nodes().Slice()))
+
+	sorted, err := DirectedSort(f, calls)
+	require.NoError(t, err)
+	require.Equal(t, []Node{A, B, C}, sorted)
+
+	g.Associate(D, calls, B)
+	g.Associate(C, calls, A)
+	f, err = Freeze(g)
+	require.NoError(t, err)
+	_, err = DirectedSort(f, calls)
+	require.Error(t, err)
+	require.IsType(t, ErrUnorderable{}, err)
+}
+
+func TestFreezeAttributes(t *testing.T) {
+
+	A := &nodeT{id: "A", attributes: map[string]interface{}{"team": "infra"}}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(A))
+	s, err := Snapshot(g)
+	require.NoError(t, err)
+	require.NoError(t, SetAttributes(g, A, Attribute{Key: "team", Value: "web"}))
+
+	// A frozen snapshot keeps the attributes of the snapshot
+	f, err := Freeze(s)
+	require.NoError(t, err)
+	require.True(t, A == f.Node("A"))
+	attrs, err := NodeAttributes(f, A)
+	require.NoError(t, err)
+	require.Equal(t, "infra", attrs["team"])
+
+	f, err = Freeze(g)
+	require.NoError(t, err)
+	attrs, err = NodeAttributes(f, A)
+	require.NoError(t, err)
+	require.Equal(t, "web", attrs["team"])
+	_, err = NodeAttributes(f, &nodeT{id: "A"})
+	require.Error(t, err)
+
+	_, err = DirectedCycles(f, EdgeKind("calls"))
+	require.IsType(t, ErrNotSupported{}, err)
+}
+
+func TestFreezeDisassociated(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(A, B, C))
+	calls := EdgeKind("calls")
+	g.Associate(A, calls, B)
+	g.Associate(B, calls, C)
+	require.NoError(t, g.Disassociate(B, calls, C))
+
+	// C has no edges of the kind now, but is still sorted with it
+	live, err := DirectedSort(g, calls)
+	require.NoError(t, err)
+	f, err := Freeze(g)
+	require.NoError(t, err)
+	frozen, err := DirectedSort(f, calls)
+	require.NoError(t, err)
+	require.ElementsMatch(t, live, frozen)
+	require.Equal(t, []Node{A, B, C}, frozen)
+
+	require.NoError(t, g.Disassociate(A, calls, B))
+	live, err = DirectedSort(g, calls)
+	require.NoError(t, err)
+	f, err = Freeze(g)
+	require.NoError(t, err)
+	frozen, err = DirectedSort(f, calls)
+	require.NoError(t, err)
+	require.ElementsMatch(t, live, frozen)
+
+	// Both ends of an edge must be the nodes of the graph, not just have their keys
+	require.Nil(t, f.Edge(A, calls, B))
+	g.Associate(A, calls, B)
+	f, err = Freeze(g)
+	require.NoError(t, err)
+	require.NotNil(t, f.Edge(A, calls, B))
+	require.Nil(t, f.Edge(&nodeT{id: "A"}, calls, B))
+	require.Nil(t, f.Edge(A, calls, &nodeT{id: "B"}))
+}
+
+// chain builds a graph of n nodes where each node calls the next few.
+func chain(n int, options Options) GraphBuilder {
+	g := Builder(options)
+	nodes := make([]Node, n)
+	for i := range nodes {
+		nodes[i] = &nodeT{id: fmt.Sprintf("n%d", i)}
+	}
+	g.Add(nodes[0], nodes[1:]...)
+	for i := range nodes {
+		for j := i + 1; j < n && j <= i+3; j++ {
+			g.Associate(nodes[i], EdgeKind("calls"), nodes[j])
+		}
+	}
+	return g
+}
+
+func benchmarkNeighbours(b *testing.B, g Graph) {
+	n := g.Node("n500")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for range g.From(n, EdgeKind("calls")).Nodes() {
+		}
+	}
+}
+
+func BenchmarkNeighboursGraph(b *testing.B) {
+	benchmarkNeighbours(b, chain(1000, Options{}))
+}
+
+func BenchmarkNeighboursFrozen(b *testing.B) {
+	f, _ := Freeze(chain(1000, Options{}))
+	benchmarkNeighbours(b, f)
+}
+
+func BenchmarkSuccessorsFrozen(b *testing.B) {
+	f, _ := Freeze(chain(1000, Options{}))
+	n := f.Node("n500")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.Successors(n, EdgeKind("calls"))
+	}
+}
+
+func BenchmarkDirectedSortGraph(b *testing.B) {
+	g := chain(1000, Options{})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		DirectedSort(g, EdgeKind("calls"))
+	}
+}
+
+func BenchmarkDirectedSortFrozen(b *testing.B) {
+	f, _ := Freeze(chain(1000, Options{}))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		DirectedSort(f, EdgeKind("calls"))
+	}
+}
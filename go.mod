@@ -1,9 +1,15 @@
 module github.com/orkestr8/xgraph
 
-go 1.12
+go 1.18
 
 require (
 	github.com/stretchr/testify v1.3.0
+	golang.org/x/exp v0.0.0-20190125153040-c74c464bbbf2
 	golang.org/x/sync v0.0.0-20190423024810-112230192c58
 	gonum.org/v1/gonum v0.0.0-20190424212039-2a1643c79af2
 )
+
+require (
+	github.com/davecgh/go-spew v1.1.0 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+)
@@ -9,9 +9,18 @@ import (
 type graph struct {
 	Options
 
-	nextID   *nodeID
-	directed map[EdgeKind]*directed
-	nodeKeys map[interface{}]*node
+	nextID      *nodeID
+	directed    map[EdgeKind]*directed
+	nodes       NodeStore
+	nodeIndexes map[string]*index
+
+	// shared is set when the maps above are shared with a snapshot or clone, and
+	// must be copied before they are changed.
+	shared   bool
+	readOnly bool
+
+	batch     *batch // set only in the transaction of a Batch
+	observers *observers
 
 	lock sync.RWMutex
 }
@@ -30,30 +39,64 @@ func (n *nodeID) get() (v int64) {
 }
 
 func newGraph(options Options) *graph {
-	return &graph{
-		nextID:   &nodeID{value: options.NodeIDOffset},
-		Options:  options,
-		nodeKeys: map[interface{}]*node{},
-		directed: map[EdgeKind]*directed{},
+	if options.Backend == nil {
+		options.Backend = MemoryBackend{}
 	}
+	g := &graph{
+		nextID:      &nodeID{value: options.NodeIDOffset},
+		Options:     options,
+		nodes:       options.Backend.NodeStore(),
+		nodeIndexes: newIndexes(options.NodeIndexes),
+		directed:    map[EdgeKind]*directed{},
+		observers:   newObservers(options.Versioned),
+	}
+	g.load()
+	return g
 }
 
 type nodeConverter interface {
 	gonum(n Node, more ...Node) []gonum.Node
 	xgraph(n gonum.Node, more ...gonum.Node) []Node
+	nodeByID(id int64) *node
 }
 
 func (g *graph) gonum(n Node, more ...Node) []gonum.Node {
 	all := append([]Node{n}, more...)
 	out := make([]gonum.Node, len(all))
 	for i, xn := range all {
-		if n, has := g.nodeKeys[xn.NodeKey()]; has {
+		if n := g.lookup(xn.NodeKey()); n != nil {
 			out[i] = n
 		}
 	}
 	return out
 }
 
+// lookup returns the node of the key, or nil.
+func (g *graph) lookup(key NodeKey) *node {
+	if n, has := g.nodes.Get(key); has {
+		return nodeOf(n)
+	}
+	return nil
+}
+
+// nodeByID returns the node of the id, or nil.
+func (g *graph) nodeByID(id int64) *node {
+	if n, has := g.nodes.GetID(id); has {
+		return nodeOf(n)
+	}
+	return nil
+}
+
+// allNodes returns the nodes of the graph in no order.
+func (g *graph) allNodes() []*node {
+	all := make([]*node, 0, g.nodes.Len())
+	g.nodes.Range(func(n StoredNode) bool {
+		all = append(all, nodeOf(n))
+		return true
+	})
+	return all
+}
+
 func (g *graph) xgraph(n gonum.Node, more ...gonum.Node) []Node {
 	all := append([]gonum.Node{n}, more...)
 	out := make([]Node, len(all))
@@ -68,23 +111,46 @@ func (g *graph) xgraph(n gonum.Node, more ...gonum.Node) []Node {
 
 /*
  Add registers the given Nodes to the graph.  Duplicate key but with different identity is not allowed.
+ Either all the nodes are added or, on error, none of them.
 */
-func (g *graph) Add(n Node, other ...Node) error {
+func (g *graph) Add(n Node, other ...Node) (err error) {
+	defer func() { g.batch.record(err) }()
+
 	g.lock.Lock()
 	defer g.lock.Unlock()
 
+	if g.readOnly {
+		return ErrReadOnly{}
+	}
+
 	all := append([]Node{n}, other...)
+	adding := map[interface{}]Node{}
 	for i := range all {
-		found, has := g.nodeKeys[all[i].NodeKey()]
-		if !has {
-			newNode := &node{
-				Node: all[i],
-				id:   g.nextID.get(),
-			}
-			g.nodeKeys[all[i].NodeKey()] = newNode
-		} else if found.Node != all[i] {
+		found := g.lookup(all[i].NodeKey())
+		if found != nil && found.Node != all[i] {
 			return ErrDuplicateKey{all[i]}
 		}
+		if found != nil {
+			continue
+		}
+		if other, has := adding[all[i].NodeKey()]; has && other != all[i] {
+			return ErrDuplicateKey{all[i]}
+		}
+		if err := g.Schema.checkNode(all[i]); err != nil {
+			return err
+		}
+		adding[all[i].NodeKey()] = all[i]
+	}
+
+	for i := range all {
+		if _, has := g.nodes.Get(all[i].NodeKey()); has {
+			continue
+		}
+		g.own()
+		added := newNode(all[i], g.nextID.get())
+		g.nodes.Put(added.stored())
+		g.indexNode(added)
+		g.emit(Event{Type: NodeAdded, Node: all[i]})
 	}
 
 	return nil
@@ -94,33 +160,191 @@ func (g *graph) Node(k NodeKey) Node {
 	g.lock.RLock()
 	defer g.lock.RUnlock()
 
-	if n, has := g.nodeKeys[k]; has {
+	if n := g.lookup(k); n != nil {
 		return n.Node
 	}
 	return nil
 }
 
+// NodeAttributes returns the attributes the graph has for the node.  They are those of the
+// node when it was added or its attributes were last set through the graph, so a snapshot
+// keeps them while the node itself has the attributes set later.  For a Frozen graph they
+// are those the graph had when it was frozen.
+func NodeAttributes(g Graph, n Node) (map[string]interface{}, error) {
+	if f, is := g.(*Frozen); is {
+		i, has := f.index[n.NodeKey()]
+		if !has || f.nodes[i] != n {
+			return nil, ErrNoSuchNode{Node: n, context: "attributes"}
+		}
+		return copyAttributes(f.nodeAttrs[i]), nil
+	}
+	xg, ok := g.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{g}
+	}
+	xg.lock.RLock()
+	defer xg.lock.RUnlock()
+
+	found := xg.lookup(n.NodeKey())
+	if found == nil || found.Node != n {
+		return nil, ErrNoSuchNode{Node: n, context: "attributes"}
+	}
+	return copyAttributes(found.attributes), nil
+}
+
+// SetAttributes sets attributes of a node in the graph and updates the node indexes.
+// The node must be an AttributeSetter.
+func SetAttributes(g Graph, n Node, attrs ...Attribute) (err error) {
+	xg, ok := g.(*graph)
+	if !ok {
+		return ErrNotSupported{g}
+	}
+	defer func() { xg.batch.record(err) }()
+
+	setter, is := n.(AttributeSetter)
+	if !is {
+		return ErrNotSettable{n}
+	}
+
+	xg.lock.Lock()
+	defer xg.lock.Unlock()
+
+	if xg.readOnly {
+		return ErrReadOnly{}
+	}
+	found := xg.lookup(n.NodeKey())
+	if found == nil || found.Node != n {
+		return ErrNoSuchNode{Node: n, context: "set"}
+	}
+	xg.own()
+	setter.SetAttributes(attrs...)
+	found.attributes = copyAttributes(nodeAttributes(n))
+	xg.nodes.Put(found.stored())
+	xg.indexNode(found)
+	xg.emit(Event{Type: NodeChanged, Node: n, Attributes: attrs})
+	return nil
+}
+
+// directedGraph returns the graph of the kind, ready to be changed.
 func (g *graph) directedGraph(kind EdgeKind) *directed {
 	g.lock.Lock()
 	defer g.lock.Unlock()
+	return g.ownDirected(kind)
+}
+
+// ownDirected is directedGraph with the graph locked.
+func (g *graph) ownDirected(kind EdgeKind) *directed {
 	// add a new graph builder if this is a new kind
-	if _, has := g.directed[kind]; !has {
-		g.directed[kind] = newDirected(g, kind)
+	d, has := g.directed[kind]
+	if !has || d.shared {
+		g.own()
+		if has {
+			d = d.clone(g)
+		} else {
+			d = newDirected(g, kind)
+		}
+		g.directed[kind] = d
 	}
-	return g.directed[kind]
+	return d
 }
 
-func (g *graph) Associate(from Node, kind EdgeKind, to Node, attrs ...Attribute) (Edge, error) {
-	fromNode := g.nodeKeys[from.NodeKey()]
+func (g *graph) Associate(from Node, kind EdgeKind, to Node, attrs ...Attribute) (_ Edge, err error) {
+	defer func() { g.batch.record(err) }()
+
+	if g.readOnly {
+		return nil, ErrReadOnly{}
+	}
+	attrs = g.withDefaults(kind, attrs)
+
+	g.lock.RLock()
+	fromNode := g.lookup(from.NodeKey())
+	toNode := g.lookup(to.NodeKey())
+	g.lock.RUnlock()
 	if fromNode == nil {
 		return nil, ErrNoSuchNode{Node: from, context: "From"}
 	}
-	toNode := g.nodeKeys[to.NodeKey()]
 	if toNode == nil {
 		return nil, ErrNoSuchNode{Node: to, context: "To"}
 	}
 
-	return g.directedGraph(kind).associate(fromNode, toNode, attrs...), nil
+	for {
+		d := g.directedGraph(kind)
+
+		// Hold the graph so it cannot be shared while the kind is changed.
+		g.lock.RLock()
+		if d.shared {
+			g.lock.RUnlock()
+			continue
+		}
+		ed, err := d.associate(g.emit, fromNode, toNode, attrs...)
+		g.lock.RUnlock()
+		if err != nil {
+			return nil, err
+		}
+		return ed, nil
+	}
+}
+
+// Disassociate removes the edge of the kind from -> to.
+func (g *graph) Disassociate(from Node, kind EdgeKind, to Node) (err error) {
+	defer func() { g.batch.record(err) }()
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.readOnly {
+		return ErrReadOnly{}
+	}
+	fromNode := g.lookup(from.NodeKey())
+	toNode := g.lookup(to.NodeKey())
+	if fromNode == nil {
+		return ErrNoSuchNode{Node: from, context: "From"}
+	}
+	if toNode == nil {
+		return ErrNoSuchNode{Node: to, context: "To"}
+	}
+	if d, has := g.directed[kind]; !has || d.edge(fromNode.id, toNode.id) == nil {
+		return ErrNoSuchEdge{From: from, Kind: kind, To: to}
+	}
+	g.ownDirected(kind).disassociate(g.emit, fromNode.id, toNode.id)
+	return nil
+}
+
+// Remove removes the node and every edge to or from it.
+func (g *graph) Remove(n Node) (err error) {
+	defer func() { g.batch.record(err) }()
+
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	if g.readOnly {
+		return ErrReadOnly{}
+	}
+	found := g.lookup(n.NodeKey())
+	if found == nil || found.Node != n {
+		return ErrNoSuchNode{Node: n, context: "remove"}
+	}
+
+	kinds := make([]EdgeKind, 0, len(g.directed))
+	for kind, d := range g.directed {
+		d.lock.RLock()
+		if d.store.HasNode(found.id) {
+			kinds = append(kinds, kind)
+		}
+		d.lock.RUnlock()
+	}
+	sortKinds(kinds)
+	for _, kind := range kinds {
+		g.ownDirected(kind).removeNode(g.emit, found)
+	}
+
+	g.own()
+	g.nodes.Delete(n.NodeKey())
+	for _, ix := range g.nodeIndexes {
+		ix.remove(found.id)
+	}
+	g.emit(Event{Type: NodeRemoved, Node: n})
+	return nil
 }
 
 func (g *graph) Edge(from Node, kind EdgeKind, to Node) Edge {
@@ -133,7 +357,7 @@ func (g *graph) Edge(from Node, kind EdgeKind, to Node) Edge {
 	if args[0] == nil || args[1] == nil {
 		return nil
 	}
-	return directed.edges[directed.Edge(args[0].ID(), args[1].ID())]
+	return directed.edge(args[0].ID(), args[1].ID())
 }
 
 func (g *graph) From(from Node, kind EdgeKind) NodesOrEdges {
@@ -163,29 +387,30 @@ func (g *graph) find(kind EdgeKind, x Node, to bool, checks []func(Node) bool) (
 		return
 	}
 
-	arg, has := g.nodeKeys[x.NodeKey()]
-	if !has {
+	arg := g.lookup(x.NodeKey())
+	if arg == nil {
 		close(ch)
 		return
 	}
 
+	// Read the nodes from the stores while the graph is locked.
+	var result gonum.Nodes
+	if to {
+		result = directed.To(arg.ID())
+	} else {
+		result = directed.From(arg.ID())
+	}
+
 	go func() {
 		defer close(ch)
 
-		var result gonum.Nodes
-		if to {
-			result = directed.To(arg.ID())
-		} else {
-			result = directed.From(arg.ID())
-		}
-
 	loop:
 		for {
 			if next := result.Next(); !next {
 				break
 			}
 
-			eval := result.Node().(*node).Node
+			eval := directed.xgraph(result.Node())[0]
 
 			if len(checks) == 0 {
 				ch <- eval
@@ -217,36 +442,33 @@ func (g *graph) findEdges(kind EdgeKind, x Node, to bool, checks []func(Edge) bo
 		return
 	}
 
-	arg, has := g.nodeKeys[x.NodeKey()]
-	if !has {
+	arg := g.lookup(x.NodeKey())
+	if arg == nil {
 		close(ch)
 		return
 	}
 
-	go func() {
-		defer close(ch)
-
-		var result gonum.Nodes
+	// Read the edges from the stores while the graph is locked.
+	var result gonum.Nodes
+	if to {
+		result = directed.To(arg.ID())
+	} else {
+		result = directed.From(arg.ID())
+	}
+	found := []Edge{}
+	for result.Next() {
 		if to {
-			result = directed.To(arg.ID())
+			found = append(found, directed.edge(result.Node().ID(), arg.ID()))
 		} else {
-			result = directed.From(arg.ID())
+			found = append(found, directed.edge(arg.ID(), result.Node().ID()))
 		}
+	}
 
-	loop:
-		for {
-			if next := result.Next(); !next {
-				break
-			}
-
-			var eval *edge
-
-			if to {
-				eval = directed.edges[directed.Edge(result.Node().ID(), arg.ID())]
-			} else {
-				eval = directed.edges[directed.Edge(arg.ID(), result.Node().ID())]
-			}
+	go func() {
+		defer close(ch)
 
+	loop:
+		for _, eval := range found {
 			if len(checks) == 0 {
 				ch <- eval
 				continue loop
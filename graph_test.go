@@ -147,3 +147,35 @@ func TestAssociate(t *testing.T) {
 	require.Equal(t, 0, len(g.From(D, likes).Edges().Slice()), "D was not added")
 
 }
+
+func TestRemove(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B", attributes: map[string]interface{}{"team": "web"}}
+	C := &nodeT{id: "C"}
+
+	g := Builder(Options{NodeIndexes: []string{"team"}, EdgeIndexes: []string{"rate"}})
+	require.NoError(t, g.Add(A, B, C))
+
+	calls := EdgeKind("calls")
+	g.Associate(A, calls, B, Attribute{Key: "rate", Value: 1})
+	g.Associate(B, calls, C)
+	g.Associate(A, calls, C)
+
+	require.Error(t, g.Disassociate(C, calls, A))
+	require.Error(t, g.Disassociate(A, EdgeKind("owns"), B))
+	require.NoError(t, g.Disassociate(A, calls, C))
+	require.Nil(t, g.Edge(A, calls, C))
+
+	require.Error(t, g.Remove(&nodeT{id: "B"}))
+	require.NoError(t, g.Remove(B))
+	require.Nil(t, g.Node("B"))
+	require.Nil(t, g.Edge(A, calls, B))
+	require.Nil(t, g.Edge(B, calls, C))
+	require.Equal(t, 0, len(g.(Indexer).NodesByAttribute("team", "web")))
+	require.Equal(t, 0, len(g.(Indexer).EdgesByAttribute(calls, "rate", 1)))
+	require.Equal(t, 0, len(g.From(A, calls).Nodes().Slice()))
+
+	// The key can be used again
+	require.NoError(t, g.Add(&nodeT{id: "B"}))
+}
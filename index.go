@@ -0,0 +1,466 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"math"
+	"reflect"
+	"sort"
+	"time"
+)
+
+// Value classes for ordering attribute values.  Values of different classes
+// are never compared with each other; range lookups only match values of the
+// same class as the bounds.
+const (
+	classNone = iota
+	classNumber
+	classString
+	classTime
+)
+
+// orderedValue is the normalized form of an attribute value that can be ordered.
+type orderedValue struct {
+	class  int
+	number float64
+	text   string
+	time   time.Time
+}
+
+func orderedOf(v interface{}) (o orderedValue, ok bool) {
+	switch v := v.(type) {
+	case string:
+		return orderedValue{class: classString, text: v}, true
+	case time.Time:
+		return orderedValue{class: classTime, time: v}, true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return orderedValue{class: classNumber, number: float64(rv.Int())}, true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return orderedValue{class: classNumber, number: float64(rv.Uint())}, true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != f { // NaN has no place in an ordering
+			return
+		}
+		return orderedValue{class: classNumber, number: f}, true
+	}
+	return
+}
+
+func (o orderedValue) compare(other orderedValue) int {
+	if o.class != other.class {
+		return o.class - other.class
+	}
+	switch o.class {
+	case classNumber:
+		switch {
+		case o.number < other.number:
+			return -1
+		case o.number > other.number:
+			return 1
+		}
+	case classString:
+		switch {
+		case o.text < other.text:
+			return -1
+		case o.text > other.text:
+			return 1
+		}
+	case classTime:
+		switch {
+		case o.time.Before(other.time):
+			return -1
+		case o.time.After(other.time):
+			return 1
+		}
+	}
+	return 0
+}
+
+// timeKey is the equality key of a time.Time, apart from the keys of numbers.  It keeps
+// the seconds and nanoseconds apart, as nanoseconds since 1970 overflow after 2262.
+type timeKey struct {
+	seconds int64
+	nanos   int
+}
+
+// equalityKey returns the map key used for equality lookups.  Integers are
+// normalized to int64, or uint64 above the range of int64, and floats that are
+// exactly integers to the same keys, so that int(1) and float64(1) find each other
+// while distinct large integers do not.  Values that cannot be used as map keys
+// are not indexed.
+func equalityKey(v interface{}) (interface{}, bool) {
+	if v == nil {
+		return nil, false
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if u := rv.Uint(); u > math.MaxInt64 {
+			return u, true
+		}
+		return int64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		switch {
+		case f != f:
+			return nil, false
+		case f == math.Trunc(f) && f >= math.MinInt64 && f < math.MaxInt64:
+			return int64(f), true
+		case f == math.Trunc(f) && f >= math.MaxInt64 && f < math.MaxUint64:
+			return uint64(f), true
+		}
+		return f, true
+	}
+	if t, is := v.(time.Time); is {
+		return timeKey{seconds: t.Unix(), nanos: t.Nanosecond()}, true
+	}
+	if !reflect.TypeOf(v).Comparable() {
+		return nil, false
+	}
+	return v, true
+}
+
+// indexOrder gives a stable ordering for items with the same value.
+// Nodes use their id; edges use the ids of the from and to nodes.
+type indexOrder [2]int64
+
+func (o indexOrder) less(other indexOrder) bool {
+	if o[0] != other[0] {
+		return o[0] < other[0]
+	}
+	return o[1] < other[1]
+}
+
+type indexEntry struct {
+	item    interface{}
+	order   indexOrder
+	key     interface{}
+	keyed   bool
+	ordered orderedValue
+	ranged  bool
+}
+
+// index is a secondary index of attribute values for a single attribute key.
+// Items are either the ids of nodes or the ids of the nodes of an edge.
+type index struct {
+	equal  map[interface{}][]indexEntry
+	sorted []indexEntry
+	items  map[interface{}]indexEntry
+}
+
+func newIndex() *index {
+	return &index{
+		equal: map[interface{}][]indexEntry{},
+		items: map[interface{}]indexEntry{},
+	}
+}
+
+func (ix *index) insert(item interface{}, order indexOrder, value interface{}) {
+	ix.remove(item)
+
+	entry := indexEntry{item: item, order: order}
+	entry.key, entry.keyed = equalityKey(value)
+	entry.ordered, entry.ranged = orderedOf(value)
+
+	if !entry.keyed && !entry.ranged {
+		return
+	}
+	ix.items[item] = entry
+
+	if entry.keyed {
+		bucket := ix.equal[entry.key]
+		i := sort.Search(len(bucket), func(i int) bool { return order.less(bucket[i].order) })
+		bucket = append(bucket, indexEntry{})
+		copy(bucket[i+1:], bucket[i:])
+		bucket[i] = entry
+		ix.equal[entry.key] = bucket
+	}
+
+	if entry.ranged {
+		i := sort.Search(len(ix.sorted), func(i int) bool { return entry.before(ix.sorted[i]) })
+		ix.sorted = append(ix.sorted, indexEntry{})
+		copy(ix.sorted[i+1:], ix.sorted[i:])
+		ix.sorted[i] = entry
+	}
+}
+
+func (ix *index) remove(item interface{}) {
+	entry, has := ix.items[item]
+	if !has {
+		return
+	}
+	delete(ix.items, item)
+
+	if entry.keyed {
+		bucket := ix.equal[entry.key]
+		for i := range bucket {
+			if bucket[i].item == item {
+				bucket = append(bucket[:i], bucket[i+1:]...)
+				break
+			}
+		}
+		if len(bucket) == 0 {
+			delete(ix.equal, entry.key)
+		} else {
+			ix.equal[entry.key] = bucket
+		}
+	}
+
+	if entry.ranged {
+		i := sort.Search(len(ix.sorted), func(i int) bool { return !ix.sorted[i].before(entry) })
+		for ; i < len(ix.sorted); i++ {
+			if ix.sorted[i].item == item {
+				ix.sorted = append(ix.sorted[:i], ix.sorted[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+func (e indexEntry) before(other indexEntry) bool {
+	if c := e.ordered.compare(other.ordered); c != 0 {
+		return c < 0
+	}
+	return e.order.less(other.order)
+}
+
+func (ix *index) lookup(value interface{}) []interface{} {
+	key, ok := equalityKey(value)
+	if !ok {
+		return nil
+	}
+	bucket := ix.equal[key]
+	out := make([]interface{}, len(bucket))
+	for i := range bucket {
+		out[i] = bucket[i].item
+	}
+	return out
+}
+
+// lookupRange returns the items with values in the closed interval [min, max].
+// A nil bound is open on that side.
+func (ix *index) lookupRange(min, max interface{}) []interface{} {
+	r, ok := newValueRange(min, max)
+	if !ok {
+		return nil
+	}
+	start := sort.Search(len(ix.sorted), func(i int) bool { return r.started(ix.sorted[i].ordered) })
+	out := []interface{}{}
+	for i := start; i < len(ix.sorted); i++ {
+		if r.ended(ix.sorted[i].ordered) {
+			break
+		}
+		out = append(out, ix.sorted[i].item)
+	}
+	return out
+}
+
+// valueRange is a closed interval of ordered values.  Either side may be open.
+// When only one side is bounded, the range is limited to values of the same class
+// as the bound.
+type valueRange struct {
+	min, max       orderedValue
+	hasMin, hasMax bool
+}
+
+func newValueRange(min, max interface{}) (r valueRange, ok bool) {
+	if min != nil {
+		if r.min, ok = orderedOf(min); !ok {
+			return
+		}
+		r.hasMin = true
+	}
+	if max != nil {
+		if r.max, ok = orderedOf(max); !ok {
+			return
+		}
+		r.hasMax = true
+	}
+	if r.hasMin && r.hasMax && r.min.class != r.max.class {
+		return r, false
+	}
+	return r, true
+}
+
+// started reports whether the value is at or past the start of the range.
+func (r valueRange) started(o orderedValue) bool {
+	switch {
+	case r.hasMin:
+		return r.min.compare(o) <= 0
+	case r.hasMax:
+		return o.class >= r.max.class
+	}
+	return true
+}
+
+// ended reports whether the value is past the end of the range.
+func (r valueRange) ended(o orderedValue) bool {
+	switch {
+	case r.hasMax:
+		return o.compare(r.max) > 0
+	case r.hasMin:
+		return o.class > r.min.class
+	}
+	return false
+}
+
+func (r valueRange) contains(o orderedValue) bool {
+	return r.started(o) && !r.ended(o)
+}
+
+// matches reports whether the value matches an equality lookup, for scans of
+// attributes that are not indexed.
+func matches(v, value interface{}) bool {
+	k1, ok1 := equalityKey(v)
+	k2, ok2 := equalityKey(value)
+	return ok1 && ok2 && k1 == k2
+}
+
+// inRange reports whether the value falls within [min, max], for scans of attributes
+// that are not indexed.
+func inRange(v, min, max interface{}) bool {
+	o, ok := orderedOf(v)
+	if !ok {
+		return false
+	}
+	r, ok := newValueRange(min, max)
+	return ok && r.contains(o)
+}
+
+func newIndexes(keys []string) map[string]*index {
+	indexes := map[string]*index{}
+	for _, k := range keys {
+		indexes[k] = newIndex()
+	}
+	return indexes
+}
+
+func nodeAttributes(n Node) map[string]interface{} {
+	if attributer, is := n.(Attributer); is {
+		return attributer.Attributes()
+	}
+	return nil
+}
+
+func (g *graph) indexNode(n *node) {
+	if len(g.nodeIndexes) == 0 {
+		return
+	}
+	for key, ix := range g.nodeIndexes {
+		if v, has := n.attributes[key]; has {
+			ix.insert(n.id, indexOrder{n.id}, v)
+		} else {
+			ix.remove(n.id)
+		}
+	}
+}
+
+// indexEdge indexes the edge by the ids of its nodes, since the store may return another
+// value for the same edge.
+func (d *directed) indexEdge(e Edge, from, to *node) {
+	if len(d.indexes) == 0 {
+		return
+	}
+	attrs := e.Attributes()
+	for key, ix := range d.indexes {
+		if v, has := attrs[key]; has {
+			ix.insert(indexOrder{from.id, to.id}, indexOrder{from.id, to.id}, v)
+		}
+	}
+}
+
+func (d *directed) unindexEdge(from, to int64) {
+	for _, ix := range d.indexes {
+		ix.remove(indexOrder{from, to})
+	}
+}
+
+func (g *graph) NodesByAttribute(key string, value interface{}) NodeSlice {
+	return g.nodesByAttribute(key,
+		func(ix *index) []interface{} { return ix.lookup(value) },
+		func(v interface{}) bool { return matches(v, value) })
+}
+
+func (g *graph) NodesByAttributeRange(key string, min, max interface{}) NodeSlice {
+	return g.nodesByAttribute(key,
+		func(ix *index) []interface{} { return ix.lookupRange(min, max) },
+		func(v interface{}) bool { return inRange(v, min, max) })
+}
+
+func (g *graph) nodesByAttribute(key string, lookup func(*index) []interface{},
+	match func(interface{}) bool) NodeSlice {
+
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+
+	out := NodeSlice{}
+	if ix, has := g.nodeIndexes[key]; has {
+		for _, item := range lookup(ix) {
+			if n := g.nodeByID(item.(int64)); n != nil {
+				out = append(out, n.Node)
+			}
+		}
+		return out
+	}
+
+	// Not indexed: scan all the nodes in the order they were added.
+	scan := []*node{}
+	for _, n := range g.allNodes() {
+		if v, has := n.attributes[key]; has && match(v) {
+			scan = append(scan, n)
+		}
+	}
+	sort.Slice(scan, func(i, j int) bool { return scan[i].id < scan[j].id })
+	for _, n := range scan {
+		out = append(out, n.Node)
+	}
+	return out
+}
+
+func (g *graph) EdgesByAttribute(kind EdgeKind, key string, value interface{}) EdgeSlice {
+	return g.edgesByAttribute(kind, key,
+		func(ix *index) []interface{} { return ix.lookup(value) },
+		func(v interface{}) bool { return matches(v, value) })
+}
+
+func (g *graph) EdgesByAttributeRange(kind EdgeKind, key string, min, max interface{}) EdgeSlice {
+	return g.edgesByAttribute(kind, key,
+		func(ix *index) []interface{} { return ix.lookupRange(min, max) },
+		func(v interface{}) bool { return inRange(v, min, max) })
+}
+
+func (g *graph) edgesByAttribute(kind EdgeKind, key string, lookup func(*index) []interface{},
+	match func(interface{}) bool) EdgeSlice {
+
+	g.lock.RLock()
+	directed, has := g.directed[kind]
+	g.lock.RUnlock()
+
+	out := EdgeSlice{}
+	if !has {
+		return out
+	}
+
+	directed.lock.RLock()
+	defer directed.lock.RUnlock()
+
+	if ix, has := directed.indexes[key]; has {
+		for _, item := range lookup(ix) {
+			ids := item.(indexOrder)
+			out = append(out, directed.edge(ids[0], ids[1]))
+		}
+		return out
+	}
+
+	// Not indexed: scan all the edges of the kind, ordered by the from and to nodes.
+	for _, e := range directed.storedEdges() {
+		if v, has := e.Attributes()[key]; has && match(v) {
+			out = append(out, e.Edge)
+		}
+	}
+	return out
+}
@@ -0,0 +1,157 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func keys(nodes NodeSlice) []string {
+	out := []string{}
+	for _, n := range nodes {
+		out = append(out, fmt.Sprintf("%v", n.NodeKey()))
+	}
+	return out
+}
+
+func TestIndexNodes(t *testing.T) {
+
+	g := Builder(Options{NodeIndexes: []string{"team", "size"}})
+
+	A := &nodeT{id: "A", attributes: map[string]interface{}{"team": "infra", "size": 3}}
+	B := &nodeT{id: "B", attributes: map[string]interface{}{"team": "web", "size": 1.5}}
+	C := &nodeT{id: "C", attributes: map[string]interface{}{"team": "infra", "size": int64(10)}}
+	D := &nodeT{id: "D", attributes: map[string]interface{}{"team": "data", "size": "large"}}
+	E := &nodeT{id: "E"}
+
+	require.NoError(t, g.Add(A, B, C, D, E))
+
+	require.Equal(t, []string{"A", "C"}, keys(g.(Indexer).NodesByAttribute("team", "infra")))
+	require.Equal(t, []string{"B"}, keys(g.(Indexer).NodesByAttribute("team", "web")))
+	require.Equal(t, []string{}, keys(g.(Indexer).NodesByAttribute("team", "none")))
+
+	// Numbers are compared by value regardless of type
+	require.Equal(t, []string{"C"}, keys(g.(Indexer).NodesByAttribute("size", 10)))
+	require.Equal(t, []string{"A"}, keys(g.(Indexer).NodesByAttribute("size", float32(3))))
+
+	require.Equal(t, []string{"B", "A"}, keys(g.(Indexer).NodesByAttributeRange("size", 1, 5)))
+	require.Equal(t, []string{"A", "C"}, keys(g.(Indexer).NodesByAttributeRange("size", 2, nil)))
+	require.Equal(t, []string{"B", "A"}, keys(g.(Indexer).NodesByAttributeRange("size", nil, 3)))
+	require.Equal(t, []string{"D"}, keys(g.(Indexer).NodesByAttributeRange("size", "a", "z")))
+	require.Equal(t, []string{"B", "A", "C", "D"}, keys(g.(Indexer).NodesByAttributeRange("size", nil, nil)))
+	require.Equal(t, []string{}, keys(g.(Indexer).NodesByAttributeRange("size", 1, "z")))
+
+	// Adding more nodes updates the index
+	F := &nodeT{id: "F", attributes: map[string]interface{}{"team": "infra", "size": 2}}
+	require.NoError(t, g.Add(F))
+	require.Equal(t, []string{"A", "C", "F"}, keys(g.(Indexer).NodesByAttribute("team", "infra")))
+	require.Equal(t, []string{"F", "A"}, keys(g.(Indexer).NodesByAttributeRange("size", 2, 3)))
+
+	// Keys that are not indexed are scanned
+	require.Equal(t, []string{"B"}, keys(g.(Indexer).NodesByAttribute("size", 1.5)))
+	g2 := Builder(Options{})
+	require.NoError(t, g2.Add(A, B, C, D, E, F))
+	require.Equal(t, keys(g.(Indexer).NodesByAttribute("team", "infra")), keys(g2.(Indexer).NodesByAttribute("team", "infra")))
+	require.Equal(t, []string{"A", "C", "F"}, keys(g2.(Indexer).NodesByAttributeRange("size", 2, nil)))
+}
+
+func TestIndexLargeIntegers(t *testing.T) {
+
+	g := Builder(Options{NodeIndexes: []string{"id"}})
+
+	big := int64(1) << 60
+	A := &nodeT{id: "A", attributes: map[string]interface{}{"id": big}}
+	B := &nodeT{id: "B", attributes: map[string]interface{}{"id": big + 1}}
+	C := &nodeT{id: "C", attributes: map[string]interface{}{"id": uint64(1) << 63}}
+	D := &nodeT{id: "D", attributes: map[string]interface{}{"id": uint64(1)<<63 + 1}}
+	E := &nodeT{id: "E", attributes: map[string]interface{}{"id": 2.0}}
+	require.NoError(t, g.Add(A, B, C, D, E))
+
+	ix := g.(Indexer)
+	require.Equal(t, []string{"A"}, keys(ix.NodesByAttribute("id", big)))
+	require.Equal(t, []string{"B"}, keys(ix.NodesByAttribute("id", uint64(big+1))))
+	require.Equal(t, []string{"C"}, keys(ix.NodesByAttribute("id", uint64(1)<<63)))
+	require.Equal(t, []string{"D"}, keys(ix.NodesByAttribute("id", uint64(1)<<63+1)))
+	require.Equal(t, []string{"E"}, keys(ix.NodesByAttribute("id", 2)))
+	require.Equal(t, []string{}, keys(ix.NodesByAttribute("id", 2.5)))
+}
+
+func TestIndexEdges(t *testing.T) {
+
+	g := Builder(Options{EdgeIndexes: []string{"since"}})
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	require.NoError(t, g.Add(A, B, C))
+
+	likes := EdgeKind(1)
+	shares := EdgeKind(2)
+
+	t0 := time.Date(2019, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	_, err := g.Associate(A, likes, B, Attribute{Key: "since", Value: t0})
+	require.NoError(t, err)
+	_, err = g.Associate(A, likes, C, Attribute{Key: "since", Value: t0.Add(time.Hour)})
+	require.NoError(t, err)
+	_, err = g.Associate(B, shares, C, Attribute{Key: "since", Value: t0})
+	require.NoError(t, err)
+
+	found := g.(Indexer).EdgesByAttribute(likes, "since", t0)
+	require.Equal(t, 1, len(found))
+	require.Equal(t, g.Edge(A, likes, B), found[0])
+
+	found = g.(Indexer).EdgesByAttributeRange(likes, "since", t0, t0.Add(time.Hour))
+	require.Equal(t, EdgeSlice{g.Edge(A, likes, B), g.Edge(A, likes, C)}, found)
+
+	found = g.(Indexer).EdgesByAttributeRange(shares, "since", nil, t0)
+	require.Equal(t, EdgeSlice{g.Edge(B, shares, C)}, found)
+
+	require.Equal(t, 0, len(g.(Indexer).EdgesByAttribute(EdgeKind(3), "since", t0)))
+
+	// Associating again replaces the edge and its index entries
+	_, err = g.Associate(A, likes, B, Attribute{Key: "since", Value: t0.Add(2 * time.Hour)})
+	require.NoError(t, err)
+	require.Equal(t, 0, len(g.(Indexer).EdgesByAttribute(likes, "since", t0)))
+	found = g.(Indexer).EdgesByAttributeRange(likes, "since", t0.Add(time.Minute), nil)
+	require.Equal(t, EdgeSlice{g.Edge(A, likes, C), g.Edge(A, likes, B)}, found)
+
+	// Not indexed
+	_, err = g.Associate(C, likes, A, Attribute{Key: "weight", Value: 2})
+	require.NoError(t, err)
+	require.Equal(t, EdgeSlice{g.Edge(C, likes, A)}, g.(Indexer).EdgesByAttribute(likes, "weight", 2))
+	require.Equal(t, EdgeSlice{g.Edge(C, likes, A)}, g.(Indexer).EdgesByAttributeRange(likes, "weight", 0, 5))
+}
+
+func TestIndexRemove(t *testing.T) {
+
+	ix := newIndex()
+	a, b, c := "a", "b", "c"
+	ix.insert(a, indexOrder{1}, 5)
+	ix.insert(b, indexOrder{2}, 5)
+	ix.insert(c, indexOrder{3}, 1)
+	ix.insert(&nodeT{}, indexOrder{4}, map[string]int{}) // not indexable
+
+	require.Equal(t, []interface{}{a, b}, ix.lookup(5))
+	require.Equal(t, []interface{}{c, a, b}, ix.lookupRange(nil, nil))
+
+	ix.remove(a)
+	require.Equal(t, []interface{}{b}, ix.lookup(5))
+	require.Equal(t, []interface{}{c, b}, ix.lookupRange(0, 10))
+
+	ix.insert(b, indexOrder{2}, 0)
+	require.Equal(t, []interface{}{}, ix.lookup(5))
+	require.Equal(t, []interface{}{b, c}, ix.lookupRange(0, 10))
+	require.Equal(t, 2, len(ix.items))
+
+	// Times 2^64 nanoseconds apart are distinct
+	late := time.Date(2500, 1, 1, 0, 0, 0, 0, time.UTC)
+	max := time.Duration(math.MaxInt64)
+	early := late.Add(-max).Add(-max).Add(-2)
+	ix.insert(a, indexOrder{1}, late)
+	require.Equal(t, []interface{}{a}, ix.lookup(late))
+	require.Equal(t, []interface{}{}, ix.lookup(early))
+}
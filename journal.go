@@ -0,0 +1,421 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"hash/crc32"
+	"io"
+	"sort"
+	"sync"
+)
+
+// NodeCodec encodes and decodes the nodes of a journal.  Keys, edge kinds and attribute
+// values are encoded with encoding/gob, so types other than the basic ones must be
+// registered with gob.Register.
+type NodeCodec interface {
+	EncodeNode(Node) ([]byte, error)
+	DecodeNode([]byte) (Node, error)
+}
+
+var (
+	codecs     = map[string]NodeCodec{}
+	codecsLock sync.RWMutex
+)
+
+// RegisterNodeCodec registers a codec by name.  Journals record the name of their codec,
+// and Replay uses the codec registered under that name.
+func RegisterNodeCodec(name string, codec NodeCodec) {
+	codecsLock.Lock()
+	defer codecsLock.Unlock()
+	codecs[name] = codec
+}
+
+func nodeCodec(name string) (NodeCodec, error) {
+	codecsLock.RLock()
+	defer codecsLock.RUnlock()
+	codec, has := codecs[name]
+	if !has {
+		return nil, ErrNoCodec{Name: name}
+	}
+	return codec, nil
+}
+
+const (
+	journalMagic   = "xgraph-journal"
+	journalVersion = 1
+)
+
+// journalHeader is the first frame of a journal.
+type journalHeader struct {
+	Magic   string
+	Version int
+	Codec   string
+}
+
+// journalEntry is a change in a journal.  The node of a NodeAdded entry written by Compact
+// has the attributes the graph had for it, which may not be those the node has now.
+type journalEntry struct {
+	Type       EventType
+	Node       []byte
+	Key        interface{}
+	From       interface{}
+	Kind       interface{}
+	To         interface{}
+	Attributes []Attribute
+	Attributed bool // the Attributes of the node are set
+}
+
+// Journal records the changes to a graph to a writer.  Each change is a frame: the length
+// and the CRC-32 of the change, then the change encoded with gob.
+type Journal struct {
+	w      io.Writer
+	codec  NodeCodec
+	cancel func()
+
+	written uint64 // sequence of the last event written
+	err     error
+	cond    *sync.Cond
+	lock    sync.Mutex
+
+	graph *graph
+}
+
+// Record writes a journal of the graph to the writer: the graph as it is now, then every
+// change to it as it happens.  Changes are written in order by an observer of the graph;
+// call Sync to wait for them.
+func Record(g GraphBuilder, w io.Writer, codec string) (*Journal, error) {
+	xg, ok := g.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{g}
+	}
+	c, err := nodeCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+
+	j := newJournal(w, c)
+	state := j.follow(xg)
+	if err := j.writeState(codec, state); err != nil {
+		j.cancel()
+		return nil, err
+	}
+	return j, nil
+}
+
+func newJournal(w io.Writer, codec NodeCodec) *Journal {
+	j := &Journal{w: w, codec: codec}
+	j.cond = sync.NewCond(&j.lock)
+	return j
+}
+
+// follow subscribes the journal to the changes to the graph and returns the graph as it is
+// before them.
+func (j *Journal) follow(xg *graph) graphState {
+	// Lock the graph so no change is between the state and the first event.
+	xg.lock.Lock()
+	defer xg.lock.Unlock()
+
+	j.graph = xg
+	xg.observers.lock.Lock()
+	j.written = xg.observers.sequence
+	xg.observers.lock.Unlock()
+
+	// The journal must see every change, so its queue has no limit.
+	j.cancel = xg.observers.subscribe(ObserverFunc(j.observe), 0)
+	return xg.state()
+}
+
+// Compact writes a journal with only the graph as it is now, which Replay rebuilds faster
+// than the journal of all its changes.
+func Compact(g Graph, w io.Writer, codec string) error {
+	xg, ok := g.(*graph)
+	if !ok {
+		return ErrNotSupported{g}
+	}
+	c, err := nodeCodec(codec)
+	if err != nil {
+		return err
+	}
+
+	xg.lock.RLock()
+	state := xg.state()
+	xg.lock.RUnlock()
+
+	return newJournal(w, c).writeState(codec, state)
+}
+
+// Sync waits for the changes made before it to be written and returns the first error
+// writing the journal.
+func (j *Journal) Sync() error {
+	j.graph.observers.lock.Lock()
+	last := j.graph.observers.sequence
+	j.graph.observers.lock.Unlock()
+
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	for j.written < last && j.err == nil {
+		j.cond.Wait()
+	}
+	return j.err
+}
+
+// Close syncs the journal and stops recording.
+func (j *Journal) Close() error {
+	err := j.Sync()
+	j.cancel()
+	return err
+}
+
+func (j *Journal) observe(e Event) {
+	j.lock.Lock()
+	defer j.lock.Unlock()
+	defer j.cond.Broadcast()
+
+	j.written = e.Sequence
+	if j.err != nil {
+		return
+	}
+	entry := journalEntry{Type: e.Type, Attributes: e.Attributes}
+	switch e.Type {
+	case NodeAdded:
+		entry.Node, j.err = j.codec.EncodeNode(e.Node)
+	case NodeRemoved, NodeChanged:
+		entry.Key = e.Node.NodeKey()
+	case EdgeAssociated, EdgeChanged, EdgeDisassociated:
+		entry.From, entry.Kind, entry.To = e.Edge.From().NodeKey(), e.Edge.Kind(), e.Edge.To().NodeKey()
+		if e.Type != EdgeDisassociated {
+			entry.Attributes = edgeAttributes(e.Edge)
+		}
+	}
+	if j.err == nil {
+		j.err = writeFrame(j.w, entry)
+	}
+}
+
+// graphState is a copy of the nodes and the edges of a graph.
+type graphState struct {
+	nodes []*node
+	edges []*edge
+}
+
+// state copies the nodes and the edges of the graph, which must be locked.
+func (g *graph) state() graphState {
+	s := graphState{nodes: g.allNodes()}
+	sort.Slice(s.nodes, func(i, j int) bool { return s.nodes[i].id < s.nodes[j].id })
+
+	kinds := make([]EdgeKind, 0, len(g.directed))
+	for kind := range g.directed {
+		kinds = append(kinds, kind)
+	}
+	sortKinds(kinds)
+	for _, kind := range kinds {
+		d := g.directed[kind]
+		d.lock.RLock()
+		s.edges = append(s.edges, d.sortedEdges()...)
+		d.lock.RUnlock()
+	}
+	return s
+}
+
+func (j *Journal) writeState(codec string, s graphState) error {
+	if err := writeFrame(j.w, journalHeader{Magic: journalMagic, Version: journalVersion, Codec: codec}); err != nil {
+		return err
+	}
+	for _, n := range s.nodes {
+		buff, err := j.codec.EncodeNode(n.Node)
+		if err != nil {
+			return err
+		}
+		attrs := make([]Attribute, 0, len(n.attributes))
+		for k, v := range n.attributes {
+			attrs = append(attrs, Attribute{Key: k, Value: v})
+		}
+		sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+		entry := journalEntry{Type: NodeAdded, Node: buff, Attributes: attrs, Attributed: true}
+		if err := writeFrame(j.w, entry); err != nil {
+			return err
+		}
+	}
+	for _, e := range s.edges {
+		entry := journalEntry{
+			Type:       EdgeAssociated,
+			From:       e.from.NodeKey(),
+			Kind:       e.kind,
+			To:         e.to.NodeKey(),
+			Attributes: e.attributes,
+		}
+		if err := writeFrame(j.w, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func edgeAttributes(e Edge) []Attribute {
+	if ed, is := e.(*edge); is {
+		return ed.attributes
+	}
+	attrs := []Attribute{}
+	for k, v := range e.Attributes() {
+		attrs = append(attrs, Attribute{Key: k, Value: v})
+	}
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	return attrs
+}
+
+func writeFrame(w io.Writer, v interface{}) error {
+	payload := bytes.Buffer{}
+	if err := gob.NewEncoder(&payload).Encode(v); err != nil {
+		return err
+	}
+	frame := make([]byte, 8, 8+payload.Len())
+	binary.BigEndian.PutUint32(frame[0:], uint32(payload.Len()))
+	binary.BigEndian.PutUint32(frame[4:], crc32.ChecksumIEEE(payload.Bytes()))
+	_, err := w.Write(append(frame, payload.Bytes()...))
+	return err
+}
+
+// maxFrame is the largest payload of a frame, so a corrupt length is not allocated.
+const maxFrame = 64 << 20
+
+// errTornFrame is the reason of ErrCorruptJournal for a frame cut short, as by a crash while
+// it was written.
+const errTornFrame = "truncated frame"
+
+// readFrame reads the next frame into v.  It returns io.EOF at the end of the journal, and
+// ErrCorruptJournal for a frame cut short.
+func readFrame(r *bufio.Reader, offset *int64, v interface{}) error {
+	start := *offset
+	head := make([]byte, 8)
+	n, err := io.ReadFull(r, head)
+	*offset += int64(n)
+	if err == io.ErrUnexpectedEOF {
+		return ErrCorruptJournal{Offset: start, reason: errTornFrame}
+	}
+	if err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(head[0:])
+	if size > maxFrame {
+		return ErrCorruptJournal{Offset: start, reason: "frame too large"}
+	}
+	payload := make([]byte, size)
+	n, err = io.ReadFull(r, payload)
+	*offset += int64(n)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		return ErrCorruptJournal{Offset: start, reason: errTornFrame}
+	}
+	if err != nil {
+		return err
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(head[4:]) {
+		return ErrCorruptJournal{Offset: start, reason: "checksum mismatch"}
+	}
+	if err := gob.NewDecoder(bytes.NewReader(payload)).Decode(v); err != nil {
+		return ErrCorruptJournal{Offset: start, reason: err.Error()}
+	}
+	return nil
+}
+
+// Replay rebuilds a graph from a journal written by Record or Compact.  The nodes are
+// decoded with the codec registered under the name in the journal.
+func Replay(r io.Reader) (GraphBuilder, error) {
+	return ReplayWith(r, Options{})
+}
+
+// ReplayWith is Replay of a graph with the options.
+func ReplayWith(r io.Reader, options Options) (GraphBuilder, error) {
+	in := bufio.NewReader(r)
+	offset := int64(0)
+
+	header := journalHeader{}
+	if err := readFrame(in, &offset, &header); err != nil {
+		if err == io.EOF {
+			return nil, ErrCorruptJournal{Offset: 0, reason: "missing header"}
+		}
+		return nil, err
+	}
+	if header.Magic != journalMagic {
+		return nil, ErrCorruptJournal{Offset: 0, reason: "not a journal"}
+	}
+	if header.Version != journalVersion {
+		return nil, ErrCorruptJournal{Offset: 0, reason: "unsupported version"}
+	}
+	codec, err := nodeCodec(header.Codec)
+	if err != nil {
+		return nil, err
+	}
+
+	g := Builder(options)
+	for {
+		entry := journalEntry{}
+		start := offset
+		err := readFrame(in, &offset, &entry)
+		if err == io.EOF {
+			return g, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := replay(g, codec, entry); err != nil {
+			return nil, ErrCorruptJournal{Offset: start, reason: err.Error()}
+		}
+	}
+}
+
+func replay(g GraphBuilder, codec NodeCodec, entry journalEntry) error {
+	node := func(key interface{}) Node {
+		if n := g.Node(key); n != nil {
+			return n
+		}
+		return &missingNode{key}
+	}
+
+	switch entry.Type {
+	case NodeAdded:
+		n, err := codec.DecodeNode(entry.Node)
+		if err != nil {
+			return err
+		}
+		if err := g.Add(n); err != nil {
+			return err
+		}
+		if entry.Attributed {
+			g.(*graph).restoreAttributes(n, entry.Attributes)
+		}
+		return nil
+	case NodeRemoved:
+		return g.Remove(node(entry.Key))
+	case NodeChanged:
+		return SetAttributes(g, node(entry.Key), entry.Attributes...)
+	case EdgeAssociated, EdgeChanged:
+		_, err := g.Associate(node(entry.From), entry.Kind, node(entry.To), entry.Attributes...)
+		return err
+	case EdgeDisassociated:
+		return g.Disassociate(node(entry.From), entry.Kind, node(entry.To))
+	}
+	return nil
+}
+
+// restoreAttributes sets the attributes the graph has for the node, without changing the node.
+func (g *graph) restoreAttributes(n Node, attrs []Attribute) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	g.own()
+	found := g.lookup(n.NodeKey())
+	found.attributes = attributeMap(attrs)
+	g.nodes.Put(found.stored())
+	g.indexNode(found)
+}
+
+// missingNode stands for a key that is not in the graph, so replaying fails with ErrNoSuchNode.
+type missingNode struct {
+	key interface{}
+}
+
+func (n *missingNode) NodeKey() NodeKey {
+	return n.key
+}
@@ -0,0 +1,133 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"bytes"
+	"encoding/gob"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type nodeTCodec struct{}
+
+type nodeTRecord struct {
+	ID         string
+	Attributes map[string]interface{}
+}
+
+func (nodeTCodec) EncodeNode(n Node) ([]byte, error) {
+	buff := bytes.Buffer{}
+	err := gob.NewEncoder(&buff).Encode(nodeTRecord{ID: n.(*nodeT).id, Attributes: n.(*nodeT).attributes})
+	return buff.Bytes(), err
+}
+
+func (nodeTCodec) DecodeNode(buff []byte) (Node, error) {
+	r := nodeTRecord{}
+	err := gob.NewDecoder(bytes.NewReader(buff)).Decode(&r)
+	return &nodeT{id: r.ID, attributes: r.Attributes}, err
+}
+
+func init() {
+	RegisterNodeCodec("nodeT", nodeTCodec{})
+}
+
+func TestJournal(t *testing.T) {
+
+	A := &nodeT{id: "A", attributes: map[string]interface{}{"team": "web"}}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	calls := EdgeKind("calls")
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(A))
+
+	buff := bytes.Buffer{}
+	_, err := Record(g, &buff, "unknown")
+	require.Equal(t, ErrNoCodec{Name: "unknown"}, err)
+
+	j, err := Record(g, &buff, "nodeT")
+	require.NoError(t, err)
+
+	require.NoError(t, g.Add(B, C))
+	g.Associate(A, calls, B, Attribute{Key: "rate", Value: 1})
+	g.Associate(B, calls, C)
+	g.Associate(A, calls, C)
+	g.Associate(A, calls, B, Attribute{Key: "rate", Value: 2})
+	require.NoError(t, SetAttributes(g, C, Attribute{Key: "team", Value: "db"}))
+	require.NoError(t, g.Disassociate(A, calls, C))
+	require.NoError(t, j.Close())
+
+	// Changes after Close are not recorded
+	require.NoError(t, g.Add(&nodeT{id: "D"}))
+
+	replayed, err := Replay(bytes.NewReader(buff.Bytes()))
+	require.NoError(t, err)
+	require.Nil(t, replayed.Node("D"))
+	require.Equal(t, "web", replayed.Node("A").(*nodeT).attributes["team"])
+	require.Equal(t, "db", replayed.Node("C").(*nodeT).attributes["team"])
+
+	rA, rB, rC := replayed.Node("A"), replayed.Node("B"), replayed.Node("C")
+	require.Equal(t, 2, replayed.Edge(rA, calls, rB).Attributes()["rate"])
+	require.NotNil(t, replayed.Edge(rB, calls, rC))
+	require.Nil(t, replayed.Edge(rA, calls, rC))
+
+	// A write cut short, in the payload or the head of the frame, is corrupt
+	_, err = Replay(bytes.NewReader(buff.Bytes()[:buff.Len()-3]))
+	require.IsType(t, ErrCorruptJournal{}, err)
+	_, err = Replay(bytes.NewReader(append(append([]byte{}, buff.Bytes()...), 0, 0, 1)))
+	require.IsType(t, ErrCorruptJournal{}, err)
+
+	// as is a frame longer than any written
+	huge := append(append([]byte{}, buff.Bytes()...), 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 0)
+	_, err = Replay(bytes.NewReader(huge))
+	require.Equal(t, ErrCorruptJournal{Offset: int64(buff.Len()), reason: "frame too large"}, err)
+
+	corrupt := append([]byte{}, buff.Bytes()...)
+	corrupt[len(corrupt)-1] ^= 0xff
+	_, err = Replay(bytes.NewReader(corrupt))
+	require.Error(t, err)
+
+	_, err = Replay(bytes.NewReader([]byte("not a journal")))
+	require.Error(t, err)
+}
+
+func TestCompact(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	calls := EdgeKind("calls")
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(A, B, C))
+	g.Associate(A, calls, B)
+	g.Associate(B, EdgeKind("owns"), C, Attribute{Key: "since", Value: 2019})
+	require.NoError(t, g.Remove(C))
+
+	buff := bytes.Buffer{}
+	require.NoError(t, Compact(g, &buff, "nodeT"))
+
+	replayed, err := Replay(&buff)
+	require.NoError(t, err)
+	require.Nil(t, replayed.Node("C"))
+	require.NotNil(t, replayed.Edge(replayed.Node("A"), calls, replayed.Node("B")))
+
+	diff, err := Diff(g, replayed)
+	require.NoError(t, err)
+	require.True(t, diff.Empty())
+
+	// A snapshot is written with the attributes it has for its nodes
+	require.NoError(t, SetAttributes(g, A, Attribute{Key: "team", Value: "web"}))
+	s, err := Snapshot(g)
+	require.NoError(t, err)
+	require.NoError(t, SetAttributes(g, A, Attribute{Key: "team", Value: "db"}))
+
+	buff.Reset()
+	require.NoError(t, Compact(s, &buff, "nodeT"))
+	replayed, err = ReplayWith(&buff, Options{NodeIndexes: []string{"team"}})
+	require.NoError(t, err)
+	attrs, err := NodeAttributes(replayed, replayed.Node("A"))
+	require.NoError(t, err)
+	require.Equal(t, "web", attrs["team"])
+	require.Equal(t, []string{"A"}, keys(replayed.(Indexer).NodesByAttribute("team", "web")))
+}
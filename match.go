@@ -0,0 +1,239 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"sort"
+)
+
+// MatchOptions control MatchPattern.
+type MatchOptions struct {
+
+	// NodeMatch tells if a node of the pattern can be mapped to a node of the graph.
+	// Any node matches if nil.
+	NodeMatch func(pattern, target Node) bool
+
+	// EdgeMatch tells if an edge of the pattern can be mapped to an edge of the same kind
+	// in the graph.  Any edge matches if nil.
+	EdgeMatch func(pattern, target Edge) bool
+
+	// MaxMatches is the maximum number of matches returned.  No limit if 0.
+	MaxMatches int
+}
+
+// MatchPattern finds every place the pattern graph appears in the graph, in the style
+// of VF2.  Each match maps every node of the pattern to a different node of the graph
+// such that every edge of the pattern has an edge of the same kind between the mapped
+// nodes.  The graph may have more edges between the mapped nodes than the pattern.
+// Matches are ordered by the nodes in the order they were added to the graph.
+func MatchPattern(pattern, g Graph, options MatchOptions) ([]map[Node]Node, error) {
+	p, ok := pattern.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{pattern}
+	}
+	xg, ok := g.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{g}
+	}
+
+	p.lock.RLock()
+	kinds := []EdgeKind{}
+	for kind := range p.directed {
+		kinds = append(kinds, kind)
+	}
+	p.lock.RUnlock()
+	sortKinds(kinds)
+
+	m := &matcher{
+		options: options,
+		pattern: p.snapshot(kinds),
+		target:  xg.snapshot(kinds),
+	}
+	m.order()
+	m.core = map[int64]*node{}
+	m.used = map[int64]bool{}
+	m.matches = []map[Node]Node{}
+	if len(m.sequence) > 0 {
+		m.match(0)
+	}
+	return m.matches, nil
+}
+
+// snapshot is a copy of the nodes and of the edges of some kinds of a graph.
+type snapshot struct {
+	nodes []*node
+	out   []map[int64]map[int64]Edge
+	in    []map[int64]map[int64]Edge
+}
+
+func (g *graph) snapshot(kinds []EdgeKind) *snapshot {
+	s := &snapshot{}
+
+	g.lock.RLock()
+	s.nodes = g.allNodes()
+	directed := make([]*directed, len(kinds))
+	for i, kind := range kinds {
+		directed[i] = g.directed[kind]
+	}
+	g.lock.RUnlock()
+	sort.Slice(s.nodes, func(i, j int) bool { return s.nodes[i].id < s.nodes[j].id })
+
+	for _, d := range directed {
+		out, in := map[int64]map[int64]Edge{}, map[int64]map[int64]Edge{}
+		if d != nil {
+			d.lock.RLock()
+			for _, e := range d.storedEdges() {
+				if out[e.from] == nil {
+					out[e.from] = map[int64]Edge{}
+				}
+				if in[e.to] == nil {
+					in[e.to] = map[int64]Edge{}
+				}
+				out[e.from][e.to] = e.Edge
+				in[e.to][e.from] = e.Edge
+			}
+			d.lock.RUnlock()
+		}
+		s.out = append(s.out, out)
+		s.in = append(s.in, in)
+	}
+	return s
+}
+
+type matcher struct {
+	options MatchOptions
+	pattern *snapshot
+	target  *snapshot
+
+	// sequence is the order the pattern nodes are matched in.  Each node after the first
+	// of its connected component has a neighbor earlier in the sequence.
+	sequence []*node
+
+	core    map[int64]*node // pattern node id -> target node
+	used    map[int64]bool  // target node ids in core
+	matches []map[Node]Node
+}
+
+// order puts the pattern nodes in the sequence: components by their first node, and within
+// a component the unplaced node with the most edges to placed nodes, then the most edges.
+func (m *matcher) order() {
+	degree := func(n *node) int {
+		total := 0
+		for k := range m.pattern.out {
+			total += len(m.pattern.out[k][n.id]) + len(m.pattern.in[k][n.id])
+		}
+		return total
+	}
+	placed := map[int64]bool{}
+	links := map[int64]int{}
+	for len(m.sequence) < len(m.pattern.nodes) {
+		var best *node
+		for _, n := range m.pattern.nodes {
+			if placed[n.id] {
+				continue
+			}
+			if best == nil || links[n.id] > links[best.id] ||
+				(links[n.id] == links[best.id] && degree(n) > degree(best)) {
+				best = n
+			}
+		}
+		placed[best.id] = true
+		m.sequence = append(m.sequence, best)
+		for k := range m.pattern.out {
+			for id := range m.pattern.out[k][best.id] {
+				links[id]++
+			}
+			for id := range m.pattern.in[k][best.id] {
+				links[id]++
+			}
+		}
+	}
+}
+
+// match maps the pattern node at position i of the sequence and returns false to stop.
+func (m *matcher) match(i int) bool {
+	if i == len(m.sequence) {
+		found := map[Node]Node{}
+		for _, n := range m.pattern.nodes {
+			found[n.Node] = m.core[n.id].Node
+		}
+		m.matches = append(m.matches, found)
+		return m.options.MaxMatches == 0 || len(m.matches) < m.options.MaxMatches
+	}
+
+	pn := m.sequence[i]
+	for _, tn := range m.candidates(pn) {
+		if m.used[tn.id] || !m.feasible(pn, tn) {
+			continue
+		}
+		m.core[pn.id] = tn
+		m.used[tn.id] = true
+		more := m.match(i + 1)
+		delete(m.core, pn.id)
+		delete(m.used, tn.id)
+		if !more {
+			return false
+		}
+	}
+	return true
+}
+
+// candidates are the target nodes adjacent to the image of a matched neighbor of the
+// pattern node, or all the target nodes if it has none.
+func (m *matcher) candidates(pn *node) []*node {
+	for k := range m.pattern.out {
+		for id := range m.pattern.in[k][pn.id] {
+			if tn, has := m.core[id]; has {
+				return m.targets(m.target.out[k][tn.id])
+			}
+		}
+		for id := range m.pattern.out[k][pn.id] {
+			if tn, has := m.core[id]; has {
+				return m.targets(m.target.in[k][tn.id])
+			}
+		}
+	}
+	return m.target.nodes
+}
+
+func (m *matcher) targets(edges map[int64]Edge) []*node {
+	out := make([]*node, 0, len(edges))
+	for _, n := range m.target.nodes {
+		if _, has := edges[n.id]; has {
+			out = append(out, n)
+		}
+	}
+	return out
+}
+
+// feasible checks the pattern node can be mapped to the target node: the nodes match,
+// the target node has at least as many edges of each kind, and every edge to or from a
+// matched pattern node has a matching edge in the target.
+func (m *matcher) feasible(pn, tn *node) bool {
+	if m.options.NodeMatch != nil && !m.options.NodeMatch(pn.Node, tn.Node) {
+		return false
+	}
+	for k := range m.pattern.out {
+		pOut, pIn := m.pattern.out[k][pn.id], m.pattern.in[k][pn.id]
+		tOut, tIn := m.target.out[k][tn.id], m.target.in[k][tn.id]
+		if len(pOut) > len(tOut) || len(pIn) > len(tIn) {
+			return false
+		}
+		for id, pe := range pOut {
+			if other, has := m.core[id]; has && !m.edgeMatch(pe, tOut[other.id]) {
+				return false
+			}
+		}
+		for id, pe := range pIn {
+			if other, has := m.core[id]; has && !m.edgeMatch(pe, tIn[other.id]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func (m *matcher) edgeMatch(pattern, target Edge) bool {
+	if target == nil {
+		return false
+	}
+	return m.options.EdgeMatch == nil || m.options.EdgeMatch(pattern, target)
+}
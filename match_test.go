@@ -0,0 +1,82 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchPattern(t *testing.T) {
+
+	depends := EdgeKind("depends")
+
+	// A depends on B and C, and B depends on C
+	PA := &nodeT{id: "A"}
+	PB := &nodeT{id: "B"}
+	PC := &nodeT{id: "C"}
+	pattern := Builder(Options{})
+	require.NoError(t, pattern.Add(PA, PB, PC))
+	pattern.Associate(PA, depends, PB)
+	pattern.Associate(PA, depends, PC)
+	pattern.Associate(PB, depends, PC)
+
+	app := &nodeT{id: "app", attributes: map[string]interface{}{"tier": "web"}}
+	api := &nodeT{id: "api", attributes: map[string]interface{}{"tier": "service"}}
+	db := &nodeT{id: "db", attributes: map[string]interface{}{"tier": "data"}}
+	cache := &nodeT{id: "cache", attributes: map[string]interface{}{"tier": "data"}}
+	log := &nodeT{id: "log", attributes: map[string]interface{}{"tier": "data"}}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(app, api, db, cache, log))
+	g.Associate(app, depends, api)
+	g.Associate(app, depends, db)
+	g.Associate(api, depends, db)
+	g.Associate(api, depends, cache)
+	g.Associate(db, depends, log, Attribute{Key: "async", Value: true})
+	g.Associate(cache, depends, log)
+	g.Associate(api, depends, log)
+
+	matches, err := MatchPattern(pattern, g, MatchOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []map[Node]Node{
+		{PA: app, PB: api, PC: db},
+		{PA: api, PB: db, PC: log},
+		{PA: api, PB: cache, PC: log},
+	}, matches)
+
+	// Only where the A node is a service
+	matches, err = MatchPattern(pattern, g, MatchOptions{
+		NodeMatch: func(p, t Node) bool {
+			return p != PA || t.(Attributer).Attributes()["tier"] == "service"
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, 2, len(matches))
+
+	// Only synchronous dependencies
+	matches, err = MatchPattern(pattern, g, MatchOptions{
+		EdgeMatch: func(p, t Edge) bool {
+			return t.Attributes()["async"] == nil
+		},
+	})
+	require.NoError(t, err)
+	require.Equal(t, []map[Node]Node{
+		{PA: app, PB: api, PC: db},
+		{PA: api, PB: cache, PC: log},
+	}, matches)
+
+	matches, err = MatchPattern(pattern, g, MatchOptions{MaxMatches: 1})
+	require.NoError(t, err)
+	require.Equal(t, 1, len(matches))
+
+	// Kinds are matched
+	other := Builder(Options{})
+	require.NoError(t, other.Add(PA, PB))
+	other.Associate(PA, EdgeKind("owns"), PB)
+	matches, err = MatchPattern(other, g, MatchOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 0, len(matches))
+
+	_, err = MatchPattern(nil, g, MatchOptions{})
+	require.Error(t, err)
+}
@@ -0,0 +1,197 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"math"
+)
+
+// MaxFlowResult is the maximum flow from a source to a sink.  Flow is the flow on each
+// edge that carries any, and Cut are the edges of a minimum cut: saturated edges from the
+// nodes the source can still reach to the rest.  Their total capacity equals Value.
+type MaxFlowResult struct {
+	Value float64
+	Flow  map[Edge]float64
+	Cut   EdgeSlice
+}
+
+// MaxFlow computes the maximum flow from source to sink through the edges of the kind with
+// the algorithm of Dinic.  The capacity of each edge is given by capacity, for example
+// EdgeAttributeWeight("capacity", 0); every edge has a capacity of 1 if nil.  Capacities
+// may not be negative.  Cut edges are ordered by when their nodes were added to the graph.
+func MaxFlow(g Graph, kind EdgeKind, source, sink Node, capacity EdgeWeightFunc) (*MaxFlowResult, error) {
+	xg, ok := g.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{g}
+	}
+	ends := xg.gonum(source, sink)
+	if ends[0] == nil {
+		return nil, ErrNoSuchNode{Node: source, context: "source"}
+	}
+	if ends[1] == nil {
+		return nil, ErrNoSuchNode{Node: sink, context: "sink"}
+	}
+	if capacity == nil {
+		capacity = unitWeight
+	}
+
+	result := &MaxFlowResult{Flow: map[Edge]float64{}, Cut: EdgeSlice{}}
+	err := scopeDirected(g, kind,
+
+		func(dg *directed) error {
+			dg.lock.RLock()
+			defer dg.lock.RUnlock()
+
+			if ends[0].ID() == ends[1].ID() ||
+				dg.Node(ends[0].ID()) == nil || dg.Node(ends[1].ID()) == nil {
+				return nil
+			}
+
+			n := newFlowNetwork()
+			edges := dg.storedEdges()
+			arcs := make([]int, len(edges))
+			for i, e := range edges {
+				c := capacity(e.Edge)
+				if c < 0 {
+					return ErrNegativeWeight{Edge: e.Edge}
+				}
+				arcs[i] = n.addArc(e.from, e.to, c)
+			}
+
+			// An end left in the kind without edges has no flow.
+			s, hasSource := n.index[ends[0].ID()]
+			t, hasSink := n.index[ends[1].ID()]
+			if !hasSource || !hasSink {
+				return nil
+			}
+			result.Value = n.maxFlow(s, t)
+
+			reachable := n.reachable(s)
+			for i, e := range edges {
+				a := n.arcs[arcs[i]]
+				if flow := a.capacity - a.residual; flow > flowEpsilon {
+					result.Flow[e.Edge] = flow
+				}
+				from := n.arcs[a.reverse].to
+				if reachable[from] && !reachable[a.to] {
+					result.Cut = append(result.Cut, e.Edge)
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// flowEpsilon is the residual capacity treated as none, against rounding of float capacities.
+const flowEpsilon = 1e-12
+
+type flowArc struct {
+	to       int
+	capacity float64
+	residual float64
+	reverse  int
+}
+
+// flowNetwork is the residual network of Dinic's algorithm, with the nodes numbered from 0.
+type flowNetwork struct {
+	index map[int64]int
+	out   [][]int
+	arcs  []flowArc
+}
+
+func newFlowNetwork() *flowNetwork {
+	return &flowNetwork{index: map[int64]int{}}
+}
+
+func (n *flowNetwork) node(id int64) int {
+	if i, has := n.index[id]; has {
+		return i
+	}
+	n.index[id] = len(n.out)
+	n.out = append(n.out, nil)
+	return len(n.out) - 1
+}
+
+// addArc adds an arc and its reverse in the residual network and returns the arc.
+func (n *flowNetwork) addArc(fromID, toID int64, capacity float64) int {
+	from, to := n.node(fromID), n.node(toID)
+	a := len(n.arcs)
+	n.arcs = append(n.arcs,
+		flowArc{to: to, capacity: capacity, residual: capacity, reverse: a + 1},
+		flowArc{to: from, reverse: a})
+	n.out[from] = append(n.out[from], a)
+	n.out[to] = append(n.out[to], a+1)
+	return a
+}
+
+func (n *flowNetwork) maxFlow(s, t int) float64 {
+	total := 0.
+	for {
+		level := n.levels(s)
+		if level[t] < 0 {
+			return total
+		}
+		next := make([]int, len(n.out))
+		for {
+			pushed := n.augment(s, t, math.Inf(1), level, next)
+			if pushed <= flowEpsilon {
+				break
+			}
+			total += pushed
+		}
+	}
+}
+
+// levels returns the distance of each node from s in the residual network, or -1.
+func (n *flowNetwork) levels(s int) []int {
+	level := make([]int, len(n.out))
+	for i := range level {
+		level[i] = -1
+	}
+	level[s] = 0
+	queue := []int{s}
+	for len(queue) > 0 {
+		u := queue[0]
+		queue = queue[1:]
+		for _, a := range n.out[u] {
+			arc := n.arcs[a]
+			if arc.residual > flowEpsilon && level[arc.to] < 0 {
+				level[arc.to] = level[u] + 1
+				queue = append(queue, arc.to)
+			}
+		}
+	}
+	return level
+}
+
+// augment pushes up to limit along a path of increasing levels from u to t and returns
+// the amount pushed.  next holds the arc to try next at each node.
+func (n *flowNetwork) augment(u, t int, limit float64, level, next []int) float64 {
+	if u == t {
+		return limit
+	}
+	for ; next[u] < len(n.out[u]); next[u]++ {
+		a := n.out[u][next[u]]
+		arc := n.arcs[a]
+		if arc.residual <= flowEpsilon || level[arc.to] != level[u]+1 {
+			continue
+		}
+		if pushed := n.augment(arc.to, t, math.Min(limit, arc.residual), level, next); pushed > flowEpsilon {
+			n.arcs[a].residual -= pushed
+			n.arcs[arc.reverse].residual += pushed
+			return pushed
+		}
+	}
+	return 0
+}
+
+// reachable marks the nodes reachable from s in the residual network.
+func (n *flowNetwork) reachable(s int) []bool {
+	level := n.levels(s)
+	seen := make([]bool, len(level))
+	for i := range level {
+		seen[i] = level[i] >= 0
+	}
+	return seen
+}
@@ -0,0 +1,89 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMaxFlow(t *testing.T) {
+
+	S := &nodeT{id: "s"}
+	V1 := &nodeT{id: "v1"}
+	V2 := &nodeT{id: "v2"}
+	V3 := &nodeT{id: "v3"}
+	V4 := &nodeT{id: "v4"}
+	T := &nodeT{id: "t"}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(S, V1, V2, V3, V4, T))
+
+	pipes := EdgeKind("pipes")
+	pipe := func(from, to Node, capacity int) {
+		_, err := g.Associate(from, pipes, to, Attribute{Key: "capacity", Value: capacity})
+		require.NoError(t, err)
+	}
+	pipe(S, V1, 16)
+	pipe(S, V2, 13)
+	pipe(V1, V3, 12)
+	pipe(V2, V1, 4)
+	pipe(V2, V4, 14)
+	pipe(V3, V2, 9)
+	pipe(V3, T, 20)
+	pipe(V4, V3, 7)
+	pipe(V4, T, 4)
+
+	capacity := EdgeAttributeWeight("capacity", 0)
+	result, err := MaxFlow(g, pipes, S, T, capacity)
+	require.NoError(t, err)
+	require.Equal(t, 23., result.Value)
+
+	// Flow is conserved and within capacity
+	balance := map[Node]float64{}
+	for e, flow := range result.Flow {
+		require.True(t, flow <= capacity(e))
+		balance[e.From()] -= flow
+		balance[e.To()] += flow
+	}
+	require.Equal(t, map[Node]float64{S: -23, V1: 0, V2: 0, V3: 0, V4: 0, T: 23}, balance)
+
+	require.Equal(t, EdgeSlice{
+		g.Edge(V1, pipes, V3),
+		g.Edge(V4, pipes, V3),
+		g.Edge(V4, pipes, T),
+	}, result.Cut)
+
+	// Unit capacities count the edge disjoint paths
+	result, err = MaxFlow(g, pipes, S, T, nil)
+	require.NoError(t, err)
+	require.Equal(t, 2., result.Value)
+
+	result, err = MaxFlow(g, pipes, T, S, capacity)
+	require.NoError(t, err)
+	require.Equal(t, 0., result.Value)
+	require.Equal(t, EdgeSlice{}, result.Cut)
+
+	_, err = MaxFlow(g, pipes, S, &nodeT{id: "none"}, capacity)
+	require.Error(t, err)
+
+	pipe(V1, V2, -1)
+	_, err = MaxFlow(g, pipes, S, T, capacity)
+	require.IsType(t, ErrNegativeWeight{}, err)
+
+	// Ends left in the kind without edges
+	A := &nodeT{id: "a"}
+	B := &nodeT{id: "b"}
+	C := &nodeT{id: "c"}
+	D := &nodeT{id: "d"}
+	g = Builder(Options{})
+	require.NoError(t, g.Add(A, B, C, D))
+	pipe(B, C, 1)
+	pipe(C, D, 1)
+	pipe(A, D, 1)
+	require.NoError(t, g.Disassociate(A, pipes, D))
+
+	result, err = MaxFlow(g, pipes, A, D, capacity)
+	require.NoError(t, err)
+	require.Equal(t, 0., result.Value)
+	require.Equal(t, EdgeSlice{}, result.Cut)
+}
@@ -0,0 +1,91 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+// KindDescriptor describes an edge kind.
+type KindDescriptor struct {
+
+	// Description is what the edges of the kind mean.
+	Description string
+
+	// Attributes are the default attributes of the edges of the kind.  Associate adds those
+	// whose keys are not given.
+	Attributes []Attribute
+}
+
+// Attributes returns the attributes of the graph, from Options.Attributes.
+func (g *graph) Attributes() map[string]interface{} {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	return attributeMap(g.Options.Attributes)
+}
+
+// attributeMap returns the attributes by key.  The last attribute of a key wins.
+func attributeMap(attrs []Attribute) map[string]interface{} {
+	m := make(map[string]interface{}, len(attrs))
+	for _, a := range attrs {
+		m[a.Key] = a.Value
+	}
+	return m
+}
+
+// Descriptor returns the descriptor of the kind, from Options.Kinds, or false.
+func (g *graph) Descriptor(kind EdgeKind) (KindDescriptor, bool) {
+	g.lock.RLock()
+	defer g.lock.RUnlock()
+	desc, has := g.Options.Kinds[kind]
+	return desc, has
+}
+
+// withDefaults returns the attributes with the default attributes of the kind whose keys
+// are not given.
+func (g *graph) withDefaults(kind EdgeKind, attrs []Attribute) []Attribute {
+	g.lock.RLock()
+	defaults := g.Options.Kinds[kind].Attributes
+	g.lock.RUnlock()
+	if len(defaults) == 0 {
+		return attrs
+	}
+
+	given := map[string]bool{}
+	for _, a := range attrs {
+		given[a.Key] = true
+	}
+	out := []Attribute{}
+	for _, a := range defaults {
+		if !given[a.Key] {
+			out = append(out, a)
+		}
+	}
+	return append(out, attrs...)
+}
+
+// setAttribute sets an attribute of the graph, replacing the one of the same key.
+func (g *graph) setAttribute(attr Attribute) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.Options.Attributes = setAttribute(g.Options.Attributes, attr)
+}
+
+// describe sets the descriptor of the kind.  The map of descriptors may be shared with
+// copies of the graph, so it is copied.
+func (g *graph) describe(kind EdgeKind, desc KindDescriptor) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	kinds := map[EdgeKind]KindDescriptor{kind: desc}
+	for k, v := range g.Options.Kinds {
+		if k != kind {
+			kinds[k] = v
+		}
+	}
+	g.Options.Kinds = kinds
+}
+
+// setAttribute returns a copy of the attributes with the attribute set.
+func setAttribute(attrs []Attribute, attr Attribute) []Attribute {
+	out := make([]Attribute, 0, len(attrs)+1)
+	for _, a := range attrs {
+		if a.Key != attr.Key {
+			out = append(out, a)
+		}
+	}
+	return append(out, attr)
+}
@@ -0,0 +1,54 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetadata(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+
+	calls := EdgeKind("calls")
+	g := Builder(Options{
+		Attributes: []Attribute{{Key: "name", Value: "services"}, {Key: "version", Value: 3}},
+		Kinds: map[EdgeKind]KindDescriptor{
+			calls: {
+				Description: "A calls B",
+				Attributes:  []Attribute{{Key: "protocol", Value: "http"}, {Key: "rate", Value: 1}},
+			},
+		},
+	})
+	require.NoError(t, g.Add(A, B, C))
+
+	require.Equal(t, map[string]interface{}{"name": "services", "version": 3}, g.Attributes())
+
+	desc, has := g.Descriptor(calls)
+	require.True(t, has)
+	require.Equal(t, "A calls B", desc.Description)
+	_, has = g.Descriptor(EdgeKind("owns"))
+	require.False(t, has)
+
+	// The defaults are added unless given
+	e, err := g.Associate(A, calls, B, Attribute{Key: "rate", Value: 5})
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{"protocol": "http", "rate": 5}, e.Attributes())
+
+	e, err = g.Associate(B, EdgeKind("owns"), C)
+	require.NoError(t, err)
+	require.Equal(t, map[string]interface{}{}, e.Attributes())
+
+	f, err := Freeze(g)
+	require.NoError(t, err)
+	require.Equal(t, g.Attributes(), f.Attributes())
+	desc, has = f.Descriptor(calls)
+	require.True(t, has)
+	require.Equal(t, "A calls B", desc.Description)
+
+	s, err := Snapshot(g)
+	require.NoError(t, err)
+	require.Equal(t, g.Attributes(), s.Attributes())
+}
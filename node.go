@@ -5,10 +5,35 @@ import (
 	"sort"
 )
 
+// node is a node of the graph as read from its store.
 type node struct {
 	Node
 	id int64 // gonum id
 
+	// attributes are those of the node when the graph last saw them set, so a snapshot
+	// keeps them when another graph sharing the node sets new ones.
+	attributes map[string]interface{}
+}
+
+// newNode returns the node of the graph for n, with a copy of its attributes.
+func newNode(n Node, id int64) *node {
+	return &node{Node: n, id: id, attributes: copyAttributes(nodeAttributes(n))}
+}
+
+func nodeOf(s StoredNode) *node {
+	return &node{Node: s.Node, id: s.ID, attributes: s.Attributes}
+}
+
+func (n *node) stored() StoredNode {
+	return StoredNode{Node: n.Node, ID: n.id, Attributes: n.attributes}
+}
+
+func copyAttributes(attrs map[string]interface{}) map[string]interface{} {
+	copied := make(map[string]interface{}, len(attrs))
+	for k, v := range attrs {
+		copied[k] = v
+	}
+	return copied
 }
 
 func (n *node) ID() int64 {
@@ -24,3 +24,12 @@ func (n *nodeT) String() string {
 func (n *nodeT) Attributes() map[string]interface{} {
 	return n.attributes
 }
+
+func (n *nodeT) SetAttributes(attrs ...Attribute) {
+	if n.attributes == nil {
+		n.attributes = map[string]interface{}{}
+	}
+	for _, a := range attrs {
+		n.attributes[a.Key] = a.Value
+	}
+}
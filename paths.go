@@ -0,0 +1,348 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"container/heap"
+	"context"
+	"fmt"
+	"math"
+	"sort"
+
+	gonum "gonum.org/v1/gonum/graph"
+)
+
+// Paths is a stream of paths.
+type Paths <-chan Path
+
+// Slice collects the paths of the stream.
+func (paths Paths) Slice() []Path {
+	all := []Path{}
+	for p := range paths {
+		all = append(all, p)
+	}
+	return all
+}
+
+// PathOptions limit the enumeration of paths.
+type PathOptions struct {
+
+	// Context stops the enumeration when done.  The stream is closed early.
+	Context context.Context
+
+	// MaxLength is the maximum number of edges in a path.  No limit if 0.
+	MaxLength int
+
+	// MaxPaths is the maximum number of paths returned.  No limit if 0.
+	MaxPaths int
+}
+
+// AllSimplePaths streams every path from -> to in the kind that does not visit a node twice.
+// Paths are found depth first, following edges in the order their nodes were added to
+// the graph.  The edges are copied when called, so the graph can change while the paths
+// are read.  The stream must be read to the end, or the Context cancelled.
+func AllSimplePaths(g Graph, kind EdgeKind, from, to Node, options PathOptions) (Paths, error) {
+	xg, ok := g.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{g}
+	}
+	ends := xg.gonum(from, to)
+	if ends[0] == nil {
+		return nil, ErrNoSuchNode{Node: from, context: "From"}
+	}
+	if ends[1] == nil {
+		return nil, ErrNoSuchNode{Node: to, context: "To"}
+	}
+
+	ch := make(chan Path)
+	out := map[int64][]*node{}
+	err := scopeDirected(g, kind,
+
+		func(dg *directed) error {
+			dg.lock.RLock()
+			defer dg.lock.RUnlock()
+
+			for _, n := range dg.sortedNodes() {
+				for _, next := range sortNodesByID(gonum.NodesOf(dg.From(n.ID()))) {
+					out[n.ID()] = append(out[n.ID()], next.(*node))
+				}
+			}
+			return nil
+		})
+	if err != nil {
+		return nil, err
+	}
+
+	ctx := options.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	go func() {
+		defer close(ch)
+
+		start, end := ends[0].(*node), ends[1].(*node)
+		count := 0
+		onPath := map[int64]bool{start.id: true}
+		current := Path{start.Node}
+
+		// visit returns false when the enumeration should stop.
+		var visit func(n *node) bool
+		visit = func(n *node) bool {
+			if n.id == end.id {
+				found := make(Path, len(current))
+				copy(found, current)
+				select {
+				case ch <- found:
+				case <-ctx.Done():
+					return false
+				}
+				count++
+				return options.MaxPaths == 0 || count < options.MaxPaths
+			}
+			if options.MaxLength > 0 && len(current) > options.MaxLength {
+				return true
+			}
+			for _, next := range out[n.id] {
+				if onPath[next.id] {
+					continue
+				}
+				onPath[next.id] = true
+				current = append(current, next.Node)
+				more := visit(next)
+				current = current[:len(current)-1]
+				onPath[next.id] = false
+				if !more {
+					return false
+				}
+			}
+			return ctx.Err() == nil
+		}
+		visit(start)
+	}()
+
+	return ch, nil
+}
+
+// KShortestPaths returns up to k of the shortest paths from -> to in the kind that do not
+// visit a node twice, in order of their total weight, with the algorithm of Yen.  If weight
+// is nil, every edge weighs 1.  Weights may not be negative.
+func KShortestPaths(g Graph, kind EdgeKind, from, to Node, k int, weight EdgeWeightFunc) (paths []Path, err error) {
+	xg, ok := g.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{g}
+	}
+	ends := xg.gonum(from, to)
+	if ends[0] == nil {
+		return nil, ErrNoSuchNode{Node: from, context: "From"}
+	}
+	if ends[1] == nil {
+		return nil, ErrNoSuchNode{Node: to, context: "To"}
+	}
+	if weight == nil {
+		weight = unitWeight
+	}
+
+	paths = []Path{}
+	err = scopeDirected(g, kind,
+
+		func(dg *directed) error {
+			dg.lock.RLock()
+			defer dg.lock.RUnlock()
+
+			if dg.Node(ends[0].ID()) == nil || dg.Node(ends[1].ID()) == nil {
+				return nil
+			}
+			c := &yen{out: map[int64][]weightedEdge{}}
+			for _, e := range dg.storedEdges() {
+				w := weight(e.Edge)
+				if w < 0 {
+					return ErrNegativeWeight{Edge: e.Edge}
+				}
+				c.out[e.from] = append(c.out[e.from], weightedEdge{to: e.to, weight: w})
+			}
+			for _, p := range c.shortest(ends[0].ID(), ends[1].ID(), k) {
+				gn := make([]gonum.Node, len(p))
+				for i, id := range p {
+					gn[i] = dg.Node(id)
+				}
+				paths = append(paths, dg.xgraph(gn[0], gn[1:]...))
+			}
+			return nil
+		})
+	return
+}
+
+type weightedEdge struct {
+	to     int64
+	weight float64
+}
+
+// yen finds the k shortest loopless paths over a copy of the edges, ordered by node id.
+type yen struct {
+	out map[int64][]weightedEdge
+}
+
+type yenPath struct {
+	nodes  []int64
+	weight float64
+}
+
+// less orders paths by weight, then by number of nodes, then by node ids.
+func (p yenPath) less(other yenPath) bool {
+	if p.weight != other.weight {
+		return p.weight < other.weight
+	}
+	if len(p.nodes) != len(other.nodes) {
+		return len(p.nodes) < len(other.nodes)
+	}
+	for i := range p.nodes {
+		if p.nodes[i] != other.nodes[i] {
+			return p.nodes[i] < other.nodes[i]
+		}
+	}
+	return false
+}
+
+func (y *yen) shortest(from, to int64, k int) [][]int64 {
+	found := [][]int64{}
+	if k <= 0 {
+		return found
+	}
+	first, ok := y.dijkstra(from, to, nil, nil)
+	if !ok {
+		return found
+	}
+
+	accepted := []yenPath{first}
+	candidates := []yenPath{}
+	seen := map[string]bool{fmt.Sprint(first.nodes): true}
+
+	for len(accepted) < k {
+		last := accepted[len(accepted)-1]
+		rootWeight := 0.
+		for i := 0; i < len(last.nodes)-1; i++ {
+			spur, root := last.nodes[i], last.nodes[:i+1]
+
+			// Leave out the edges that continue the same root in paths already found,
+			// and the nodes of the root, so the new path is different and loopless.
+			edges := map[[2]int64]bool{}
+			for _, p := range accepted {
+				if len(p.nodes) > i+1 && equalIDs(p.nodes[:i+1], root) {
+					edges[[2]int64{p.nodes[i], p.nodes[i+1]}] = true
+				}
+			}
+			nodes := map[int64]bool{}
+			for _, id := range root[:i] {
+				nodes[id] = true
+			}
+
+			if spurPath, ok := y.dijkstra(spur, to, nodes, edges); ok {
+				total := yenPath{
+					nodes:  append(append([]int64{}, root[:i]...), spurPath.nodes...),
+					weight: rootWeight + spurPath.weight,
+				}
+				if key := fmt.Sprint(total.nodes); !seen[key] {
+					seen[key] = true
+					candidates = append(candidates, total)
+				}
+			}
+			rootWeight += y.weight(last.nodes[i], last.nodes[i+1])
+		}
+
+		if len(candidates) == 0 {
+			break
+		}
+		sort.Slice(candidates, func(i, j int) bool { return candidates[i].less(candidates[j]) })
+		accepted = append(accepted, candidates[0])
+		candidates = candidates[1:]
+	}
+
+	for _, p := range accepted {
+		found = append(found, p.nodes)
+	}
+	return found
+}
+
+func (y *yen) weight(from, to int64) float64 {
+	for _, e := range y.out[from] {
+		if e.to == to {
+			return e.weight
+		}
+	}
+	return math.Inf(1)
+}
+
+// dijkstra finds the shortest path from -> to without the given nodes and edges.
+func (y *yen) dijkstra(from, to int64, nodes map[int64]bool, edges map[[2]int64]bool) (yenPath, bool) {
+	dist := map[int64]float64{from: 0}
+	prev := map[int64]int64{}
+	done := map[int64]bool{}
+	queue := &distanceHeap{{id: from}}
+
+	for queue.Len() > 0 {
+		this := heap.Pop(queue).(distance)
+		if done[this.id] {
+			continue
+		}
+		done[this.id] = true
+		if this.id == to {
+			path := []int64{to}
+			for id := to; id != from; {
+				id = prev[id]
+				path = append([]int64{id}, path...)
+			}
+			return yenPath{nodes: path, weight: this.weight}, true
+		}
+		for _, e := range y.out[this.id] {
+			if nodes[e.to] || edges[[2]int64{this.id, e.to}] || done[e.to] {
+				continue
+			}
+			d := this.weight + e.weight
+			if old, has := dist[e.to]; !has || d < old {
+				dist[e.to] = d
+				prev[e.to] = this.id
+				heap.Push(queue, distance{id: e.to, weight: d})
+			}
+		}
+	}
+	return yenPath{}, false
+}
+
+func equalIDs(a, b []int64) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+type distance struct {
+	id     int64
+	weight float64
+}
+
+// distanceHeap is a min heap by weight, ties broken by the lower id.
+type distanceHeap []distance
+
+func (h distanceHeap) Len() int { return len(h) }
+
+func (h distanceHeap) Less(i, j int) bool {
+	if h[i].weight != h[j].weight {
+		return h[i].weight < h[j].weight
+	}
+	return h[i].id < h[j].id
+}
+
+func (h distanceHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *distanceHeap) Push(x interface{}) { *h = append(*h, x.(distance)) }
+
+func (h *distanceHeap) Pop() interface{} {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
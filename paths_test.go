@@ -0,0 +1,96 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testDataRoutes(t *testing.T) (GraphBuilder, EdgeKind, []Node) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	D := &nodeT{id: "D"}
+	E := &nodeT{id: "E"}
+
+	g := Builder(Options{})
+	require.NoError(t, g.Add(A, B, C, D, E))
+
+	routes := EdgeKind("routes")
+	g.Associate(A, routes, B, Attribute{Key: "latency", Value: 1})
+	g.Associate(A, routes, C, Attribute{Key: "latency", Value: 1})
+	g.Associate(B, routes, C, Attribute{Key: "latency", Value: 1})
+	g.Associate(B, routes, D, Attribute{Key: "latency", Value: 1})
+	g.Associate(C, routes, D, Attribute{Key: "latency", Value: 5})
+	g.Associate(D, routes, E, Attribute{Key: "latency", Value: 1})
+	g.Associate(D, routes, A, Attribute{Key: "latency", Value: 1})
+
+	return g, routes, []Node{A, B, C, D, E}
+}
+
+func TestAllSimplePaths(t *testing.T) {
+
+	g, routes, n := testDataRoutes(t)
+	A, B, C, D, E := n[0], n[1], n[2], n[3], n[4]
+
+	paths, err := AllSimplePaths(g, routes, A, E, PathOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []Path{{A, B, C, D, E}, {A, B, D, E}, {A, C, D, E}}, paths.Slice())
+
+	paths, err = AllSimplePaths(g, routes, A, E, PathOptions{MaxLength: 3})
+	require.NoError(t, err)
+	require.Equal(t, []Path{{A, B, D, E}, {A, C, D, E}}, paths.Slice())
+
+	paths, err = AllSimplePaths(g, routes, A, E, PathOptions{MaxPaths: 1})
+	require.NoError(t, err)
+	require.Equal(t, []Path{{A, B, C, D, E}}, paths.Slice())
+
+	paths, err = AllSimplePaths(g, routes, E, A, PathOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []Path{}, paths.Slice())
+
+	paths, err = AllSimplePaths(g, EdgeKind("none"), A, E, PathOptions{})
+	require.NoError(t, err)
+	require.Equal(t, []Path{}, paths.Slice())
+
+	_, err = AllSimplePaths(g, routes, A, &nodeT{id: "none"}, PathOptions{})
+	require.Error(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	paths, err = AllSimplePaths(g, routes, A, E, PathOptions{Context: ctx})
+	require.NoError(t, err)
+	require.Equal(t, Path{A, B, C, D, E}, <-paths)
+	cancel()
+	require.True(t, len(paths.Slice()) < 2)
+}
+
+func TestKShortestPaths(t *testing.T) {
+
+	g, routes, n := testDataRoutes(t)
+	A, B, C, D, E := n[0], n[1], n[2], n[3], n[4]
+
+	latency := EdgeAttributeWeight("latency", 1)
+
+	paths, err := KShortestPaths(g, routes, A, E, 2, latency)
+	require.NoError(t, err)
+	require.Equal(t, []Path{{A, B, D, E}, {A, C, D, E}}, paths)
+
+	paths, err = KShortestPaths(g, routes, A, E, 5, latency)
+	require.NoError(t, err)
+	require.Equal(t, []Path{{A, B, D, E}, {A, C, D, E}, {A, B, C, D, E}}, paths)
+
+	paths, err = KShortestPaths(g, routes, A, E, 3, nil)
+	require.NoError(t, err)
+	require.Equal(t, 3, len(paths))
+	require.Equal(t, Path{A, B, C, D, E}, paths[2])
+
+	paths, err = KShortestPaths(g, routes, E, A, 3, latency)
+	require.NoError(t, err)
+	require.Equal(t, []Path{}, paths)
+
+	g.Associate(C, routes, E, Attribute{Key: "latency", Value: -1})
+	_, err = KShortestPaths(g, routes, A, E, 3, latency)
+	require.IsType(t, ErrNegativeWeight{}, err)
+}
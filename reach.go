@@ -0,0 +1,168 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"sort"
+
+	gonum "gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/topo"
+)
+
+// reachability answers if a path exists between two nodes of a kind by interval labelling
+// of the condensation of the kind, the DAG of its strongly connected components, after
+// Agrawal, Borgida and Jagadish, "Efficient Management of Transitive Relationships in Large
+// Data and Knowledge Bases".  Each component is numbered in the post order of a spanning
+// forest and reaches the components whose numbers are in its intervals.
+type reachability struct {
+	component map[int64]int
+	post      []int
+	intervals [][]interval
+}
+
+type interval struct {
+	low, high int
+}
+
+func newReachability(d gonum.Directed) *reachability {
+	r := &reachability{component: map[int64]int{}}
+
+	sccs := topo.TarjanSCC(d)
+	for c, scc := range sccs {
+		for _, n := range scc {
+			r.component[n.ID()] = c
+		}
+	}
+
+	// The edges of the condensation, and the components in topological order.
+	out := make([][]int, len(sccs))
+	inDegree := make([]int, len(sccs))
+	for c, scc := range sccs {
+		seen := map[int]bool{c: true}
+		for _, n := range scc {
+			for _, next := range sortNodesByID(gonum.NodesOf(d.From(n.ID()))) {
+				if to := r.component[next.ID()]; !seen[to] {
+					seen[to] = true
+					out[c] = append(out[c], to)
+					inDegree[to]++
+				}
+			}
+		}
+	}
+	order := []int{}
+	for c := range sccs {
+		if inDegree[c] == 0 {
+			order = append(order, c)
+		}
+	}
+	roots := append([]int{}, order...)
+	for i := 0; i < len(order); i++ {
+		for _, to := range out[order[i]] {
+			inDegree[to]--
+			if inDegree[to] == 0 {
+				order = append(order, to)
+			}
+		}
+	}
+
+	// Number the components in post order of a spanning forest from the roots.
+	r.post = make([]int, len(sccs))
+	low := make([]int, len(sccs))
+	visited := make([]bool, len(sccs))
+	next := 0
+	var visit func(c int)
+	visit = func(c int) {
+		visited[c] = true
+		low[c] = next
+		for _, to := range out[c] {
+			if !visited[to] {
+				visit(to)
+			}
+		}
+		r.post[c] = next
+		next++
+	}
+	for _, c := range roots {
+		visit(c)
+	}
+
+	// Each component reaches its subtree and what its successors reach.
+	r.intervals = make([][]interval, len(sccs))
+	for i := len(order) - 1; i >= 0; i-- {
+		c := order[i]
+		all := []interval{{low: low[c], high: r.post[c]}}
+		for _, to := range out[c] {
+			all = append(all, r.intervals[to]...)
+		}
+		r.intervals[c] = mergeIntervals(all)
+	}
+	return r
+}
+
+func mergeIntervals(all []interval) []interval {
+	sort.Slice(all, func(i, j int) bool { return all[i].low < all[j].low })
+	merged := []interval{}
+	for _, in := range all {
+		last := len(merged) - 1
+		if last >= 0 && in.low <= merged[last].high+1 {
+			if in.high > merged[last].high {
+				merged[last].high = in.high
+			}
+			continue
+		}
+		merged = append(merged, in)
+	}
+	return merged
+}
+
+// reaches tells if there is a path from -> to.  A node reaches itself.
+func (r *reachability) reaches(from, to int64) bool {
+	if from == to {
+		return true
+	}
+	cf, has := r.component[from]
+	if !has {
+		return false
+	}
+	ct, has := r.component[to]
+	if !has {
+		return false
+	}
+	if cf == ct {
+		return true
+	}
+	intervals, p := r.intervals[cf], r.post[ct]
+	i := sort.Search(len(intervals), func(i int) bool { return intervals[i].high >= p })
+	return i < len(intervals) && intervals[i].low <= p
+}
+
+// reachable returns the reachability index of the kind, building it if needed.  The caller
+// holds the read lock of the kind.
+func (d *directed) reachable() *reachability {
+	d.reachLock.Lock()
+	defer d.reachLock.Unlock()
+
+	if d.reach == nil {
+		d.reach = newReachability(d)
+	}
+	return d.reach
+}
+
+// invalidateReach drops the reachability index after a change that may change the paths.
+// The caller holds the lock of the kind.
+func (d *directed) invalidateReach() {
+	d.reachLock.Lock()
+	defer d.reachLock.Unlock()
+	d.reach = nil
+}
+
+// keepsReach tells if the index still holds after adding the edge from -> to: when from
+// already reaches to, the new edge adds no path.  The caller holds the lock of the kind.
+func (d *directed) keepsReach(from, to int64) bool {
+	d.reachLock.Lock()
+	defer d.reachLock.Unlock()
+	return d.reach != nil && d.reach.reaches(from, to) && d.reach.has(from) && d.reach.has(to)
+}
+
+func (r *reachability) has(id int64) bool {
+	_, has := r.component[id]
+	return has
+}
@@ -0,0 +1,114 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gonum.org/v1/gonum/graph/topo"
+)
+
+func TestReachability(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	D := &nodeT{id: "D"}
+	calls := EdgeKind("calls")
+
+	g := Builder(Options{Reachability: []EdgeKind{calls}})
+	require.NoError(t, g.Add(A, B, C, D))
+	g.Associate(A, calls, B)
+	g.Associate(B, calls, C)
+
+	exists, err := PathExistsIn(g, calls, A, C)
+	require.NoError(t, err)
+	require.True(t, exists)
+	exists, err = PathExistsIn(g, calls, C, A)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	d := g.(*graph).directed[calls]
+	require.NotNil(t, d.reach)
+
+	// An edge along an existing path keeps the index
+	g.Associate(A, calls, C)
+	require.NotNil(t, d.reach)
+
+	// A new path drops it, and it is built again by the next query
+	g.Associate(C, calls, A)
+	require.Nil(t, d.reach)
+	exists, err = PathExistsIn(g, calls, C, B)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	require.NoError(t, g.Disassociate(C, calls, A))
+	exists, err = PathExistsIn(g, calls, C, B)
+	require.NoError(t, err)
+	require.False(t, exists)
+
+	// Nodes outside the kind
+	exists, err = PathExistsIn(g, calls, D, A)
+	require.NoError(t, err)
+	require.False(t, exists)
+	exists, err = PathExistsIn(g, calls, D, D)
+	require.NoError(t, err)
+	require.True(t, exists)
+}
+
+func TestReachabilityRandom(t *testing.T) {
+
+	calls := EdgeKind("calls")
+	random := rand.New(rand.NewSource(7))
+
+	nodes := make([]Node, 40)
+	for i := range nodes {
+		nodes[i] = &nodeT{id: fmt.Sprintf("n%d", i)}
+	}
+	g := Builder(Options{Reachability: []EdgeKind{calls}})
+	require.NoError(t, g.Add(nodes[0], nodes[1:]...))
+
+	for round := 0; round < 20; round++ {
+		for i := 0; i < 5; i++ {
+			from, to := random.Intn(len(nodes)), random.Intn(len(nodes))
+			if from != to {
+				g.Associate(nodes[from], calls, nodes[to])
+			}
+		}
+		for _, e := range g.From(nodes[random.Intn(len(nodes))], calls).Edges().Slice() {
+			require.NoError(t, g.Disassociate(e.From(), calls, e.To()))
+		}
+
+		d := g.(*graph).directed[calls]
+		for _, from := range nodes {
+			for _, to := range nodes {
+				exists, err := PathExistsIn(g, calls, from, to)
+				require.NoError(t, err)
+				args := d.gonum(from, to)
+				if d.Node(args[0].ID()) == nil || d.Node(args[1].ID()) == nil {
+					require.Equal(t, from == to, exists)
+					continue
+				}
+				require.Equal(t, topo.PathExistsIn(d, args[0], args[1]), exists, "%v -> %v", from, to)
+			}
+		}
+	}
+}
+
+func benchmarkPathExistsIn(b *testing.B, options Options) {
+	g := chain(1000, options)
+	from, to := g.Node("n0"), g.Node("n999")
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		PathExistsIn(g, EdgeKind("calls"), from, to)
+	}
+}
+
+func BenchmarkPathExistsIn(b *testing.B) {
+	benchmarkPathExistsIn(b, Options{})
+}
+
+func BenchmarkPathExistsInIndexed(b *testing.B) {
+	benchmarkPathExistsIn(b, Options{Reachability: []EdgeKind{EdgeKind("calls")}})
+}
@@ -0,0 +1,282 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"reflect"
+	"sort"
+
+	gonum "gonum.org/v1/gonum/graph"
+	"gonum.org/v1/gonum/graph/topo"
+)
+
+// NodeMatcher selects the nodes a schema rule applies to.
+type NodeMatcher func(Node) bool
+
+// NodeOfType matches nodes of the same Go type as the example.
+func NodeOfType(example Node) NodeMatcher {
+	t := reflect.TypeOf(example)
+	return func(n Node) bool {
+		return reflect.TypeOf(n) == t
+	}
+}
+
+// NodeWithAttribute matches nodes that are Attributers with the given attribute value.
+func NodeWithAttribute(key string, value interface{}) NodeMatcher {
+	return func(n Node) bool {
+		v, has := nodeAttributes(n)[key]
+		return has && matches(v, value)
+	}
+}
+
+// Schema declares the constraints of a graph.  When set in Options, Add and Associate
+// reject changes that violate it.  Validate reports the violations in an existing graph.
+type Schema struct {
+
+	// Nodes are the node types allowed in the graph.  Any node is allowed if empty.
+	Nodes []NodeMatcher
+
+	// Kinds are the constraints per EdgeKind.  Kinds not listed are not constrained.
+	Kinds map[EdgeKind]KindSchema
+}
+
+// KindSchema declares the constraints on the edges of one EdgeKind.
+type KindSchema struct {
+
+	// From are the node types an edge may start from.  Any node is allowed if empty.
+	From []NodeMatcher
+
+	// To are the node types an edge may end at.  Any node is allowed if empty.
+	To []NodeMatcher
+
+	// MaxOut is the maximum number of edges from a node.  No limit if 0.
+	MaxOut int
+
+	// MaxIn is the maximum number of edges to a node.  No limit if 0.
+	MaxIn int
+
+	// Required are the attribute keys every edge must have.
+	Required []string
+
+	// Acyclic kinds may not contain cycles.
+	Acyclic bool
+}
+
+func matchAny(matchers []NodeMatcher, n Node) bool {
+	if len(matchers) == 0 {
+		return true
+	}
+	for _, m := range matchers {
+		if m(n) {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Schema) kind(kind EdgeKind) *KindSchema {
+	if s == nil {
+		return nil
+	}
+	if k, has := s.Kinds[kind]; has {
+		return &k
+	}
+	return nil
+}
+
+// kindSchema returns the rules for the kind from the schema and the acyclic kinds
+// in the options, or nil if the kind is not constrained.
+func (o Options) kindSchema(kind EdgeKind) *KindSchema {
+	k := o.Schema.kind(kind)
+	for _, acyclic := range o.Acyclic {
+		if acyclic != kind {
+			continue
+		}
+		if k == nil {
+			k = &KindSchema{}
+		}
+		k.Acyclic = true
+	}
+	return k
+}
+
+func (s *Schema) checkNode(n Node) error {
+	if s == nil || matchAny(s.Nodes, n) {
+		return nil
+	}
+	return ErrNodeType{Node: n}
+}
+
+// checkEdge checks a new edge from -> to against the rules of the kind.
+// It must be called with the directed graph locked.
+func (k *KindSchema) checkEdge(d *directed, from, to *node, attrs []Attribute) error {
+	if !matchAny(k.From, from.Node) {
+		return ErrEndpointType{Node: from.Node, Kind: d.kind, context: "From"}
+	}
+	if !matchAny(k.To, to.Node) {
+		return ErrEndpointType{Node: to.Node, Kind: d.kind, context: "To"}
+	}
+
+	for _, key := range k.Required {
+		found := false
+		for _, a := range attrs {
+			if a.Key == key {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return ErrMissingAttribute{Key: key, Kind: d.kind, From: from.Node, To: to.Node}
+		}
+	}
+
+	// Replacing an existing edge does not change the degree of either node.
+	replace := d.Node(from.id) != nil && d.Node(to.id) != nil && d.HasEdgeFromTo(from.id, to.id)
+	if !replace {
+		if k.MaxOut > 0 && d.Node(from.id) != nil && d.From(from.id).Len() >= k.MaxOut {
+			return ErrCardinality{Node: from.Node, Kind: d.kind, Limit: k.MaxOut, context: "out"}
+		}
+		if k.MaxIn > 0 && d.Node(to.id) != nil && d.To(to.id).Len() >= k.MaxIn {
+			return ErrCardinality{Node: to.Node, Kind: d.kind, Limit: k.MaxIn, context: "in"}
+		}
+	}
+
+	if d.order != nil {
+		if path := d.order.insert(d, from, to); path != nil {
+			cycle := append(Path{from.Node}, d.xgraph(path[0], path[1:]...)...)
+			return ErrCycle{Kind: d.kind, Path: cycle}
+		}
+	}
+	return nil
+}
+
+// Validate checks an existing graph against the schema and returns every violation.
+// If schema is nil, the schema the graph was built with is used.  The kinds in the
+// Acyclic option of the graph are checked for cycles too.
+func Validate(g Graph, schema *Schema) (violations []error, err error) {
+	xg, ok := g.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{g}
+	}
+	if schema == nil {
+		schema = xg.Schema
+	}
+
+	violations = []error{}
+	rules := Options{Schema: schema, Acyclic: xg.Acyclic}
+
+	xg.lock.RLock()
+	defer xg.lock.RUnlock()
+
+	if schema != nil {
+		nodes := xg.allNodes()
+		sort.Slice(nodes, func(i, j int) bool { return nodes[i].id < nodes[j].id })
+		for _, n := range nodes {
+			if err := schema.checkNode(n.Node); err != nil {
+				violations = append(violations, err)
+			}
+		}
+	}
+
+	seen := map[EdgeKind]bool{}
+	kinds := []EdgeKind{}
+	for _, kind := range rules.Acyclic {
+		if !seen[kind] {
+			seen[kind] = true
+			kinds = append(kinds, kind)
+		}
+	}
+	if schema != nil {
+		for kind := range schema.Kinds {
+			if !seen[kind] {
+				seen[kind] = true
+				kinds = append(kinds, kind)
+			}
+		}
+	}
+	sortKinds(kinds)
+
+	for _, kind := range kinds {
+		d, has := xg.directed[kind]
+		if !has {
+			continue
+		}
+		violations = append(violations, d.validate(rules.kindSchema(kind))...)
+	}
+	return
+}
+
+func (d *directed) validate(k *KindSchema) (violations []error) {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	for _, e := range d.storedEdges() {
+		from, to := e.From(), e.To()
+		if !matchAny(k.From, from) {
+			violations = append(violations, ErrEndpointType{Node: from, Kind: d.kind, context: "From"})
+		}
+		if !matchAny(k.To, to) {
+			violations = append(violations, ErrEndpointType{Node: to, Kind: d.kind, context: "To"})
+		}
+		attrs := e.Attributes()
+		for _, key := range k.Required {
+			if _, has := attrs[key]; !has {
+				violations = append(violations, ErrMissingAttribute{Key: key, Kind: d.kind, From: from, To: to})
+			}
+		}
+	}
+
+	for _, gn := range d.sortedNodes() {
+		n := gn.(*node)
+		if k.MaxOut > 0 && d.From(n.id).Len() > k.MaxOut {
+			violations = append(violations, ErrCardinality{Node: n.Node, Kind: d.kind, Limit: k.MaxOut, context: "out"})
+		}
+		if k.MaxIn > 0 && d.To(n.id).Len() > k.MaxIn {
+			violations = append(violations, ErrCardinality{Node: n.Node, Kind: d.kind, Limit: k.MaxIn, context: "in"})
+		}
+	}
+
+	if k.Acyclic {
+		for _, scc := range topo.TarjanSCC(d) {
+			if cycle := d.cycleIn(scc); cycle != nil {
+				violations = append(violations, ErrCycle{Kind: d.kind, Path: cycle})
+			}
+		}
+	}
+	return
+}
+
+// cycleIn returns a cycle through the lowest id node of a strongly connected component,
+// or nil if the component has no cycle (a single node without a self loop).
+func (d *directed) cycleIn(scc []gonum.Node) Path {
+	start := scc[0]
+	for _, n := range scc {
+		if n.ID() < start.ID() {
+			start = n
+		}
+	}
+	if len(scc) == 1 && !d.HasEdgeFromTo(start.ID(), start.ID()) {
+		return nil
+	}
+	in := map[int64]bool{}
+	for _, n := range scc {
+		in[n.ID()] = true
+	}
+	// Walk from a successor in the component back to the start.
+	successors := sortNodesByID(gonum.NodesOf(d.From(start.ID())))
+	for _, next := range successors {
+		if !in[next.ID()] {
+			continue
+		}
+		if next.ID() == start.ID() {
+			return d.xgraph(start, start)
+		}
+		if path := d.path(next.(*node), start.(*node)); path != nil {
+			return d.xgraph(start, path...)
+		}
+	}
+	return nil
+}
+
+func sortNodesByID(nodes []gonum.Node) []gonum.Node {
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID() < nodes[j].ID() })
+	return nodes
+}
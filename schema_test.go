@@ -0,0 +1,162 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type serviceT struct {
+	*nodeT
+}
+
+type teamT struct {
+	*nodeT
+}
+
+func TestSchemaAssociate(t *testing.T) {
+
+	owns := EdgeKind("owns")
+	parent := EdgeKind("parent")
+	calls := EdgeKind("calls")
+
+	schema := &Schema{
+		Nodes: []NodeMatcher{NodeOfType(&serviceT{}), NodeOfType(&teamT{})},
+		Kinds: map[EdgeKind]KindSchema{
+			owns: {
+				From: []NodeMatcher{NodeOfType(&teamT{})},
+				To:   []NodeMatcher{NodeOfType(&serviceT{})},
+				// Every service has at most one owner
+				MaxIn: 1,
+			},
+			parent: {
+				MaxOut:  1,
+				Acyclic: true,
+			},
+			calls: {
+				Required: []string{"protocol"},
+			},
+		},
+	}
+
+	g := Builder(Options{Schema: schema})
+
+	web := &serviceT{&nodeT{id: "web"}}
+	api := &serviceT{&nodeT{id: "api"}}
+	db := &serviceT{&nodeT{id: "db"}}
+	infra := &teamT{&nodeT{id: "infra"}}
+	apps := &teamT{&nodeT{id: "apps"}}
+
+	require.NoError(t, g.Add(web, api, db, infra, apps))
+
+	err := g.Add(&nodeT{id: "other"})
+	require.Error(t, err)
+	require.IsType(t, ErrNodeType{}, err)
+	require.Nil(t, g.Node("other"))
+
+	_, err = g.Associate(apps, owns, web)
+	require.NoError(t, err)
+	_, err = g.Associate(apps, owns, web)
+	require.NoError(t, err, "Replacing an edge does not count against the limit")
+	_, err = g.Associate(infra, owns, web)
+	require.IsType(t, ErrCardinality{}, err)
+	require.Nil(t, g.Edge(infra, owns, web))
+
+	_, err = g.Associate(web, owns, infra)
+	require.IsType(t, ErrEndpointType{}, err)
+	require.Equal(t, "From", err.(ErrEndpointType).context)
+
+	_, err = g.Associate(infra, owns, apps)
+	require.IsType(t, ErrEndpointType{}, err)
+	require.Equal(t, "To", err.(ErrEndpointType).context)
+
+	_, err = g.Associate(web, calls, api)
+	require.IsType(t, ErrMissingAttribute{}, err)
+	_, err = g.Associate(web, calls, api, Attribute{Key: "protocol", Value: "http"})
+	require.NoError(t, err)
+
+	_, err = g.Associate(db, parent, api)
+	require.NoError(t, err)
+	_, err = g.Associate(api, parent, web)
+	require.NoError(t, err)
+	_, err = g.Associate(db, parent, web)
+	require.IsType(t, ErrCardinality{}, err)
+
+	_, err = g.Associate(web, parent, db)
+	require.Error(t, err)
+	cycle, is := err.(ErrCycle)
+	require.True(t, is)
+	require.Equal(t, Path{web, db, api, web}, cycle.Path)
+	require.Equal(t, "Cycle in parent:web -> db -> api -> web", err.Error())
+
+	_, err = g.Associate(web, parent, web)
+	require.Equal(t, ErrCycle{Kind: parent, Path: Path{web, web}}, err)
+
+	violations, err := Validate(g, nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(violations))
+}
+
+func TestSchemaValidate(t *testing.T) {
+
+	owns := EdgeKind("owns")
+	parent := EdgeKind("parent")
+
+	g := Builder(Options{})
+
+	web := &serviceT{&nodeT{id: "web"}}
+	api := &serviceT{&nodeT{id: "api"}}
+	apps := &teamT{&nodeT{id: "apps", attributes: map[string]interface{}{"org": "eng"}}}
+	other := &nodeT{id: "other"}
+
+	require.NoError(t, g.Add(web, api, apps, other))
+
+	g.Associate(apps, owns, web)
+	g.Associate(apps, owns, api)
+	g.Associate(other, owns, web)
+	g.Associate(web, parent, api)
+	g.Associate(api, parent, web)
+
+	schema := &Schema{
+		Nodes: []NodeMatcher{NodeOfType(&serviceT{}), NodeWithAttribute("org", "eng")},
+		Kinds: map[EdgeKind]KindSchema{
+			owns: {
+				From:     []NodeMatcher{NodeOfType(&teamT{})},
+				MaxIn:    1,
+				Required: []string{"since"},
+			},
+			parent: {
+				Acyclic: true,
+			},
+			EdgeKind("unused"): {
+				Acyclic: true,
+			},
+		},
+	}
+
+	violations, err := Validate(g, schema)
+	require.NoError(t, err)
+
+	require.Equal(t, []error{
+		ErrNodeType{Node: other},
+		ErrMissingAttribute{Key: "since", Kind: owns, From: apps, To: web},
+		ErrMissingAttribute{Key: "since", Kind: owns, From: apps, To: api},
+		ErrEndpointType{Node: other, Kind: owns, context: "From"},
+		ErrMissingAttribute{Key: "since", Kind: owns, From: other, To: web},
+		ErrCardinality{Node: web, Kind: owns, Limit: 1, context: "in"},
+		ErrCycle{Kind: parent, Path: Path{web, api, web}},
+	}, violations)
+
+	violations, err = Validate(g, nil)
+	require.NoError(t, err)
+	require.Equal(t, 0, len(violations))
+
+	// Acyclic kinds of the options, with the edges made before they were set
+	g.(*graph).Acyclic = []EdgeKind{parent}
+	violations, err = Validate(g, nil)
+	require.NoError(t, err)
+	require.Equal(t, []error{ErrCycle{Kind: parent, Path: Path{web, api, web}}}, violations)
+
+	_, err = Validate(nil, schema)
+	require.Error(t, err)
+}
@@ -0,0 +1,200 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+// Clone returns a copy of the graph that can be changed independently.  The nodes are
+// the same values, so attributes set by the clone on a node it shares are set on the node,
+// while NodeAttributes of each graph returns the attributes it set.  The copy is made
+// lazily: each graph copies the nodes or the edges of a kind the first time it changes them.
+// The clone of a graph of a persistent Backend is copied in memory at once.
+func Clone(g Graph) (GraphBuilder, error) {
+	xg, ok := g.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{g}
+	}
+	return xg.share(false), nil
+}
+
+// Snapshot returns a read only view of the graph as it is now.  Later changes to the graph
+// are not seen by the snapshot, and changing the snapshot returns ErrReadOnly.  The nodes
+// are the same values, and for a node whose attributes are set later the snapshot keeps the
+// old ones: NodeAttributes returns them, and its indexes and Diff use them.  Taking a
+// snapshot is cheap: the graph copies the nodes or the edges of a kind the first time it
+// changes them after the snapshot.  The snapshot of a graph of a persistent Backend is
+// copied in memory at once.
+func Snapshot(g Graph) (Graph, error) {
+	xg, ok := g.(*graph)
+	if !ok {
+		return nil, ErrNotSupported{g}
+	}
+	return xg.share(true), nil
+}
+
+func (g *graph) share(readOnly bool) *graph {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	var f *graph
+	if g.Backend.Persistent() {
+		f = g.copy(readOnly)
+	} else {
+		if g.batch != nil {
+			g.batch.shared = true
+		}
+		g.shared = true
+		g.markShared()
+		f = g.fork(readOnly)
+	}
+
+	// Snapshots and clones of a versioned graph keep its history.
+	g.observers.lock.Lock()
+	defer g.observers.lock.Unlock()
+	f.observers.sequence = g.observers.sequence
+	if g.observers.history != nil {
+		f.observers.history = g.observers.history.share()
+	}
+	return f
+}
+
+// markShared marks the kinds that are not shared yet as shared and returns them.
+// It must be called with the graph locked.
+func (g *graph) markShared() []*directed {
+	marked := []*directed{}
+	for _, d := range g.directed {
+		// A kind that is already shared is not changed by any graph.
+		if !d.shared {
+			d.lock.Lock()
+			d.shared = true
+			d.lock.Unlock()
+			marked = append(marked, d)
+		}
+	}
+	return marked
+}
+
+// fork returns a graph sharing the maps of this graph, which must be locked and marked shared.
+func (g *graph) fork(readOnly bool) *graph {
+	g.nextID.lock.Lock()
+	next := g.nextID.value
+	g.nextID.lock.Unlock()
+
+	f := &graph{
+		Options:     g.Options,
+		nextID:      &nodeID{value: next},
+		directed:    make(map[EdgeKind]*directed, len(g.directed)),
+		nodes:       g.nodes,
+		nodeIndexes: g.nodeIndexes,
+		observers:   newObservers(false),
+		shared:      true,
+		readOnly:    readOnly,
+	}
+	for kind, d := range g.directed {
+		f.directed[kind] = d.share(f)
+	}
+	return f
+}
+
+// copy returns a graph in memory with copies of the stores of this graph, which must be
+// locked.  A graph of a persistent backend is copied so, as it changes only its own stores.
+func (g *graph) copy(readOnly bool) *graph {
+	g.nextID.lock.Lock()
+	next := g.nextID.value
+	g.nextID.lock.Unlock()
+
+	f := &graph{
+		Options:     g.Options,
+		nextID:      &nodeID{value: next},
+		directed:    make(map[EdgeKind]*directed, len(g.directed)),
+		nodes:       g.nodes.Copy(),
+		nodeIndexes: cloneIndexes(g.nodeIndexes),
+		observers:   newObservers(false),
+		readOnly:    readOnly,
+	}
+	f.Backend = MemoryBackend{}
+	for kind, d := range g.directed {
+		f.directed[kind] = d.clone(f)
+	}
+	return f
+}
+
+// share returns the graph of the kind sharing its edges, for the base graph.  The kind must
+// be marked shared, so its edges are not changed again.
+func (d *directed) share(base *graph) *directed {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	v := &directed{
+		kind:          d.kind,
+		schema:        d.schema,
+		nodeConverter: base,
+		store:         d.store,
+		values:        d.values,
+		indexes:       d.indexes,
+		order:         d.order,
+		shared:        true,
+		reachIndexed:  d.reachIndexed,
+	}
+	d.reachLock.Lock()
+	v.reach = d.reach
+	d.reachLock.Unlock()
+	return v
+}
+
+// own copies the maps of the graph if they are shared, before they are changed.
+// It must be called with the graph locked.
+func (g *graph) own() {
+	if !g.shared {
+		return
+	}
+	directed := make(map[EdgeKind]*directed, len(g.directed))
+	for k, d := range g.directed {
+		directed[k] = d
+	}
+	g.nodes = g.nodes.Copy()
+	g.directed = directed
+	g.nodeIndexes = cloneIndexes(g.nodeIndexes)
+	g.shared = false
+}
+
+// clone copies the graph of a kind for the base graph.
+func (d *directed) clone(base *graph) *directed {
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	c := &directed{
+		kind:          d.kind,
+		schema:        d.schema,
+		nodeConverter: base,
+		store:         d.store.Copy(),
+		values:        d.values.copy(),
+		indexes:       cloneIndexes(d.indexes),
+		reachIndexed:  d.reachIndexed,
+	}
+	d.reachLock.Lock()
+	c.reach = d.reach
+	d.reachLock.Unlock()
+	if d.order != nil {
+		c.order = &topoOrder{position: make(map[int64]int, len(d.order.position)), next: d.order.next}
+		for id, p := range d.order.position {
+			c.order.position[id] = p
+		}
+	}
+	return c
+}
+
+func cloneIndexes(indexes map[string]*index) map[string]*index {
+	out := make(map[string]*index, len(indexes))
+	for key, ix := range indexes {
+		c := &index{
+			equal:  make(map[interface{}][]indexEntry, len(ix.equal)),
+			sorted: append([]indexEntry{}, ix.sorted...),
+			items:  make(map[interface{}]indexEntry, len(ix.items)),
+		}
+		for k, bucket := range ix.equal {
+			c.equal[k] = append([]indexEntry{}, bucket...)
+		}
+		for item, entry := range ix.items {
+			c.items[item] = entry
+		}
+		out[key] = c
+	}
+	return out
+}
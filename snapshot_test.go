@@ -0,0 +1,184 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestSnapshot(t *testing.T) {
+
+	A := &nodeT{id: "A", attributes: map[string]interface{}{"team": "infra"}}
+	B := &nodeT{id: "B", attributes: map[string]interface{}{"team": "web"}}
+	C := &nodeT{id: "C"}
+
+	g := Builder(Options{NodeIndexes: []string{"team"}, EdgeIndexes: []string{"rate"}})
+	require.NoError(t, g.Add(A, B, C))
+
+	calls := EdgeKind("calls")
+	g.Associate(A, calls, B, Attribute{Key: "rate", Value: 1})
+
+	s, err := Snapshot(g)
+	require.NoError(t, err)
+
+	D := &nodeT{id: "D", attributes: map[string]interface{}{"team": "infra"}}
+	require.NoError(t, g.Add(D))
+	g.Associate(A, calls, B, Attribute{Key: "rate", Value: 2})
+	g.Associate(B, calls, C)
+	g.Associate(A, EdgeKind("owns"), D)
+
+	// The graph changed
+	require.Equal(t, D, g.Node("D"))
+	require.Equal(t, 2, g.Edge(A, calls, B).Attributes()["rate"])
+	require.Equal(t, []string{"A", "D"}, keys(g.(Indexer).NodesByAttribute("team", "infra")))
+	sorted, err := DirectedSort(g, calls)
+	require.NoError(t, err)
+	require.Equal(t, []Node{A, B, C}, sorted)
+
+	// The snapshot did not
+	require.Nil(t, s.Node("D"))
+	require.Equal(t, 1, s.Edge(A, calls, B).Attributes()["rate"])
+	require.Nil(t, s.Edge(B, calls, C))
+	require.Equal(t, []string{"A"}, keys(s.(Indexer).NodesByAttribute("team", "infra")))
+	require.Equal(t, 1, len(s.(Indexer).EdgesByAttribute(calls, "rate", 1)))
+	sorted, err = DirectedSort(s, calls)
+	require.NoError(t, err)
+	require.Equal(t, []Node{A, B}, sorted)
+	require.Nil(t, s.(*graph).directed[EdgeKind("owns")])
+
+	// and cannot be changed
+	require.Equal(t, ErrReadOnly{}, s.(GraphBuilder).Add(&nodeT{id: "E"}))
+	_, err = s.(GraphBuilder).Associate(A, calls, C)
+	require.Equal(t, ErrReadOnly{}, err)
+	require.Equal(t, ErrReadOnly{}, SetAttributes(s, A, Attribute{Key: "team", Value: "web"}))
+}
+
+func TestSnapshotAttributes(t *testing.T) {
+
+	A := &nodeT{id: "A", attributes: map[string]interface{}{"team": "infra"}}
+	B := &nodeT{id: "B", attributes: map[string]interface{}{"team": "web"}}
+
+	g := Builder(Options{NodeIndexes: []string{"team"}})
+	require.NoError(t, g.Add(A, B))
+	calls := EdgeKind("calls")
+	g.Associate(A, calls, B)
+
+	s, err := Snapshot(g)
+	require.NoError(t, err)
+
+	require.NoError(t, SetAttributes(g, A, Attribute{Key: "team", Value: "web"}))
+	s2, err := Snapshot(g)
+	require.NoError(t, err)
+	require.NoError(t, SetAttributes(g, A, Attribute{Key: "team", Value: "data"}))
+
+	// The graph sees the node with its new attributes
+	require.Equal(t, A, g.Node("A"))
+	require.Equal(t, []string{"A"}, keys(g.(Indexer).NodesByAttribute("team", "data")))
+	require.Equal(t, []string{"B"}, keys(g.(Indexer).NodesByAttribute("team", "web")))
+	require.Equal(t, NodeSlice{A}, g.To(calls, B).Nodes().Slice())
+
+	// Each snapshot keeps the attributes as they were, and agrees with its index
+	team := func(g Graph) interface{} {
+		attrs, err := NodeAttributes(g, A)
+		require.NoError(t, err)
+		return attrs["team"]
+	}
+	require.Equal(t, "data", team(g))
+	require.Equal(t, "infra", team(s))
+	require.Equal(t, []string{"A"}, keys(s.(Indexer).NodesByAttribute("team", "infra")))
+	require.Equal(t, "web", team(s2))
+	require.Equal(t, []string{"A", "B"}, keys(s2.(Indexer).NodesByAttribute("team", "web")))
+
+	// The nodes of a snapshot are the nodes of the graph
+	n, is := s.Node("A").(*nodeT)
+	require.True(t, is)
+	require.True(t, A == n)
+	require.True(t, A == s.(Indexer).NodesByAttribute("team", "infra")[0])
+	require.True(t, A == s.To(calls, B).Nodes().Slice()[0])
+	_, err = NodeAttributes(s, &nodeT{id: "A"})
+	require.Error(t, err)
+
+	diff, err := Diff(s, g)
+	require.NoError(t, err)
+	require.Equal(t, 1, len(diff.ChangedNodes))
+
+	// The snapshot finds its nodes in its own nodes, not in the graph
+	require.NoError(t, g.Remove(B))
+	require.NotNil(t, s.Edge(A, calls, B))
+	require.Equal(t, 1, len(s.From(A, calls).Nodes().Slice()))
+}
+
+func TestClone(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+
+	g := Builder(Options{Acyclic: []EdgeKind{EdgeKind("deps")}})
+	require.NoError(t, g.Add(A, B))
+	deps := EdgeKind("deps")
+	g.Associate(A, deps, B)
+
+	c, err := Clone(g)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Add(C))
+	_, err = c.Associate(B, deps, C)
+	require.NoError(t, err)
+	_, err = c.Associate(C, deps, A)
+	require.IsType(t, ErrCycle{}, err)
+
+	_, err = g.Associate(B, deps, A)
+	require.IsType(t, ErrCycle{}, err)
+
+	require.Nil(t, g.Node("C"))
+	require.Nil(t, g.Edge(B, deps, C))
+	require.NotNil(t, c.Edge(B, deps, C))
+
+	// Both can change without affecting the other
+	g.Associate(A, EdgeKind("owns"), B)
+	require.Nil(t, c.Edge(A, EdgeKind("owns"), B))
+
+	cc, err := Clone(c)
+	require.NoError(t, err)
+	cc.Associate(A, deps, C)
+	require.Nil(t, c.Edge(A, deps, C))
+	require.NotNil(t, cc.Edge(A, deps, C))
+}
+
+func TestSnapshotConcurrent(t *testing.T) {
+
+	g := Builder(Options{})
+	next := EdgeKind("next")
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		var last Node
+		for i := 0; i < 200; i++ {
+			n := &nodeT{id: fmt.Sprintf("N%d", i)}
+			g.Add(n)
+			if last != nil {
+				g.Associate(last, next, n)
+			}
+			last = n
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 50; i++ {
+			s, err := Snapshot(g)
+			require.NoError(t, err)
+			sorted, err := DirectedSort(s, next)
+			require.NoError(t, err)
+			// A snapshot is a prefix of the chain
+			for j, n := range sorted {
+				require.Equal(t, fmt.Sprintf("N%d", j), n.NodeKey())
+			}
+		}
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,578 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"sort"
+	"sync"
+
+	"gonum.org/v1/gonum/graph/topo"
+)
+
+// Backend stores a graph: its nodes, and the adjacency and the edge attributes of each kind.
+// The stores keep plain data, the nodes by key and by id and the edges by the ids of their
+// nodes, so a backend may keep them outside memory.  Options.Backend selects it;
+// MemoryBackend is used if it is nil.
+type Backend interface {
+	// NodeStore returns the store of the nodes.
+	NodeStore() NodeStore
+
+	// EdgeStore returns the store of the edges of the kind.
+	EdgeStore(kind EdgeKind) EdgeStore
+
+	// Kinds returns the kinds stored already.  The graph loads them with the nodes when it
+	// is made.
+	Kinds() []EdgeKind
+
+	// Persistent tells if the graph is kept outside memory.  The graph then changes only
+	// its own stores: its snapshots, clones and transactions copy them when they are made.
+	Persistent() bool
+}
+
+// StoredNode is a node as stored: the node, the id the graph gave it and the attributes the
+// graph has for it.
+type StoredNode struct {
+	Node       Node
+	ID         int64
+	Attributes map[string]interface{}
+}
+
+// NodeStore keeps the nodes of a graph by key, and finds them by id.
+type NodeStore interface {
+	Get(key NodeKey) (StoredNode, bool)
+	GetID(id int64) (StoredNode, bool)
+	Put(n StoredNode)
+	Delete(key NodeKey)
+	Len() int
+
+	// Range calls fn with each node until it returns false.
+	Range(fn func(n StoredNode) bool)
+
+	// Copy returns a store in memory with the same nodes, changed independently of this one.
+	Copy() NodeStore
+}
+
+// EdgeStore keeps the edges of one kind by the ids of their nodes: the nodes with edges of
+// the kind, the adjacency and the attributes of each edge.  The graph runs its algorithms
+// on the store.
+type EdgeStore interface {
+	AddNode(id int64)
+	HasNode(id int64) bool
+	Nodes() []int64
+
+	// RemoveNode removes the node and its edges.
+	RemoveNode(id int64)
+
+	// From returns the ids of the nodes with an edge from the node, and To those with an
+	// edge to it.
+	From(id int64) []int64
+	To(id int64) []int64
+
+	// Set sets the edge from -> to with the attributes.  Both nodes are added first.
+	Set(from, to int64, attrs []Attribute)
+	Get(from, to int64) ([]Attribute, bool)
+	Remove(from, to int64)
+
+	// Len returns the number of edges.
+	Len() int
+
+	// Range calls fn with each edge until it returns false.
+	Range(fn func(from, to int64, attrs []Attribute) bool)
+
+	// Copy returns a store in memory with the same nodes and edges, changed independently
+	// of this one.
+	Copy() EdgeStore
+}
+
+// load indexes the nodes stored by the backend, and makes the kinds it stored.
+func (g *graph) load() {
+	g.nodes.Range(func(n StoredNode) bool {
+		if n.ID >= g.nextID.value {
+			g.nextID.value = n.ID + 1
+		}
+		g.indexNode(nodeOf(n))
+		return true
+	})
+	for _, kind := range g.Backend.Kinds() {
+		d := newDirected(g, kind)
+		for _, e := range d.storedEdges() {
+			d.indexEdge(e.Edge, d.nodeByID(e.from), d.nodeByID(e.to))
+		}
+		if d.order != nil {
+			if sorted, err := topo.Sort(d); err == nil {
+				for _, n := range sorted {
+					d.order.of(n.ID())
+				}
+			}
+		}
+		g.directed[kind] = d
+	}
+}
+
+// MemoryBackend keeps the graph in maps.
+type MemoryBackend struct{}
+
+// NodeStore returns an empty store of nodes.
+func (MemoryBackend) NodeStore() NodeStore {
+	return newMemoryNodes()
+}
+
+// EdgeStore returns an empty store of edges.
+func (MemoryBackend) EdgeStore(kind EdgeKind) EdgeStore {
+	return newMemoryEdges()
+}
+
+// Kinds returns no kinds, as the stores are made empty.
+func (MemoryBackend) Kinds() []EdgeKind {
+	return nil
+}
+
+// Persistent is false.
+func (MemoryBackend) Persistent() bool {
+	return false
+}
+
+type memoryNodes struct {
+	nodes map[interface{}]StoredNode
+	keys  map[int64]interface{}
+}
+
+func newMemoryNodes() *memoryNodes {
+	return &memoryNodes{nodes: map[interface{}]StoredNode{}, keys: map[int64]interface{}{}}
+}
+
+func (m *memoryNodes) Get(key NodeKey) (StoredNode, bool) {
+	n, has := m.nodes[key]
+	return n, has
+}
+
+func (m *memoryNodes) GetID(id int64) (StoredNode, bool) {
+	key, has := m.keys[id]
+	if !has {
+		return StoredNode{}, false
+	}
+	return m.Get(key)
+}
+
+func (m *memoryNodes) Put(n StoredNode) {
+	key := n.Node.NodeKey()
+	if old, has := m.nodes[key]; has {
+		delete(m.keys, old.ID)
+	}
+	m.nodes[key] = n
+	m.keys[n.ID] = key
+}
+
+func (m *memoryNodes) Delete(key NodeKey) {
+	if old, has := m.nodes[key]; has {
+		delete(m.keys, old.ID)
+		delete(m.nodes, key)
+	}
+}
+
+func (m *memoryNodes) Len() int {
+	return len(m.nodes)
+}
+
+func (m *memoryNodes) Range(fn func(n StoredNode) bool) {
+	for _, n := range m.nodes {
+		if !fn(n) {
+			return
+		}
+	}
+}
+
+func (m *memoryNodes) Copy() NodeStore {
+	c := &memoryNodes{
+		nodes: make(map[interface{}]StoredNode, len(m.nodes)),
+		keys:  make(map[int64]interface{}, len(m.keys)),
+	}
+	for k, n := range m.nodes {
+		c.nodes[k] = n
+	}
+	for id, k := range m.keys {
+		c.keys[id] = k
+	}
+	return c
+}
+
+// memoryEdges keeps the edges from each node with their attributes, and the nodes with an
+// edge to each node.
+type memoryEdges struct {
+	from map[int64]map[int64][]Attribute
+	to   map[int64]map[int64]bool
+	len  int
+}
+
+func newMemoryEdges() *memoryEdges {
+	return &memoryEdges{from: map[int64]map[int64][]Attribute{}, to: map[int64]map[int64]bool{}}
+}
+
+func (m *memoryEdges) AddNode(id int64) {
+	if _, has := m.from[id]; !has {
+		m.from[id] = map[int64][]Attribute{}
+		m.to[id] = map[int64]bool{}
+	}
+}
+
+func (m *memoryEdges) HasNode(id int64) bool {
+	_, has := m.from[id]
+	return has
+}
+
+func (m *memoryEdges) Nodes() []int64 {
+	ids := make([]int64, 0, len(m.from))
+	for id := range m.from {
+		ids = append(ids, id)
+	}
+	return ids
+}
+
+func (m *memoryEdges) RemoveNode(id int64) {
+	for to := range m.from[id] {
+		m.Remove(id, to)
+	}
+	for from := range m.to[id] {
+		m.Remove(from, id)
+	}
+	delete(m.from, id)
+	delete(m.to, id)
+}
+
+func (m *memoryEdges) From(id int64) []int64 {
+	ids := make([]int64, 0, len(m.from[id]))
+	for to := range m.from[id] {
+		ids = append(ids, to)
+	}
+	return ids
+}
+
+func (m *memoryEdges) To(id int64) []int64 {
+	ids := make([]int64, 0, len(m.to[id]))
+	for from := range m.to[id] {
+		ids = append(ids, from)
+	}
+	return ids
+}
+
+func (m *memoryEdges) Set(from, to int64, attrs []Attribute) {
+	m.AddNode(from)
+	m.AddNode(to)
+	if _, has := m.from[from][to]; !has {
+		m.len++
+	}
+	m.from[from][to] = attrs
+	m.to[to][from] = true
+}
+
+func (m *memoryEdges) Get(from, to int64) ([]Attribute, bool) {
+	attrs, has := m.from[from][to]
+	return attrs, has
+}
+
+func (m *memoryEdges) Remove(from, to int64) {
+	if _, has := m.from[from][to]; has {
+		delete(m.from[from], to)
+		delete(m.to[to], from)
+		m.len--
+	}
+}
+
+func (m *memoryEdges) Len() int {
+	return m.len
+}
+
+func (m *memoryEdges) Range(fn func(from, to int64, attrs []Attribute) bool) {
+	for from, edges := range m.from {
+		for to, attrs := range edges {
+			if !fn(from, to, attrs) {
+				return
+			}
+		}
+	}
+}
+
+func (m *memoryEdges) Copy() EdgeStore {
+	c := &memoryEdges{
+		from: make(map[int64]map[int64][]Attribute, len(m.from)),
+		to:   make(map[int64]map[int64]bool, len(m.to)),
+		len:  m.len,
+	}
+	for id, edges := range m.from {
+		c.from[id] = make(map[int64][]Attribute, len(edges))
+		for to, attrs := range edges {
+			c.from[id][to] = attrs
+		}
+	}
+	for id, edges := range m.to {
+		c.to[id] = make(map[int64]bool, len(edges))
+		for from := range edges {
+			c.to[id][from] = true
+		}
+	}
+	return c
+}
+
+const (
+	fileMagic   = "xgraph-file"
+	fileVersion = 1
+)
+
+// Operations of the records of a FileBackend.
+const (
+	filePutNode = iota
+	fileDeleteNode
+	fileAddEdgeNode
+	fileRemoveEdgeNode
+	fileSetEdge
+	fileRemoveEdge
+)
+
+// fileRecord is a change to a store of a FileBackend.
+type fileRecord struct {
+	Op         int
+	Node       []byte
+	Key        interface{}
+	ID         int64
+	Kind       interface{}
+	From       int64
+	To         int64
+	Attributes []Attribute
+}
+
+// FileBackend keeps a graph in a file.  Its stores are kept in memory too, and each change
+// to them is appended to the file as a frame, from which OpenFile loads them again.  Nodes
+// are encoded with a codec registered by RegisterNodeCodec.  A FileBackend stores one graph:
+// build it with the backend in Options.Backend, and close the backend when done.
+type FileBackend struct {
+	file  *os.File
+	codec NodeCodec
+	nodes *fileNodes
+	kinds map[EdgeKind]*fileEdges
+	err   error // the first error writing the file
+	lock  sync.Mutex
+}
+
+// OpenFile opens the file of a FileBackend, or creates it, with the codec registered under
+// the name.  A change cut short in the file by a crash is dropped.
+func OpenFile(path, codec string) (*FileBackend, error) {
+	c, err := nodeCodec(codec)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	b := &FileBackend{file: f, codec: c, kinds: map[EdgeKind]*fileEdges{}}
+	b.nodes = &fileNodes{memoryNodes: newMemoryNodes(), backend: b}
+	if err := b.load(codec); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return b, nil
+}
+
+// load reads the stores from the file and truncates a last frame cut short, or writes the
+// header of a new file.
+func (b *FileBackend) load(codec string) error {
+	info, err := b.file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() == 0 {
+		return writeFrame(b.file, journalHeader{Magic: fileMagic, Version: fileVersion, Codec: codec})
+	}
+
+	in := bufio.NewReader(b.file)
+	offset := int64(0)
+	header := journalHeader{}
+	if err := readFrame(in, &offset, &header); err != nil {
+		return err
+	}
+	if header.Magic != fileMagic || header.Version != fileVersion {
+		return ErrCorruptJournal{Offset: 0, reason: "not a graph file"}
+	}
+	if header.Codec != codec {
+		return ErrCorruptJournal{Offset: 0, reason: "codec " + header.Codec}
+	}
+	for {
+		record := fileRecord{}
+		start := offset
+		err := readFrame(in, &offset, &record)
+		if corrupt, is := err.(ErrCorruptJournal); is && corrupt.reason == errTornFrame {
+			if err := b.file.Truncate(start); err != nil {
+				return err
+			}
+			err = io.EOF
+			offset = start
+		}
+		if err == io.EOF {
+			_, err = b.file.Seek(offset, io.SeekStart)
+			return err
+		}
+		if err != nil {
+			return err
+		}
+		if err := b.apply(record); err != nil {
+			return ErrCorruptJournal{Offset: start, reason: err.Error()}
+		}
+	}
+}
+
+// apply makes the change of a record to the stores in memory.
+func (b *FileBackend) apply(r fileRecord) error {
+	switch r.Op {
+	case filePutNode:
+		n, err := b.codec.DecodeNode(r.Node)
+		if err != nil {
+			return err
+		}
+		b.nodes.memoryNodes.Put(StoredNode{Node: n, ID: r.ID, Attributes: attributeMap(r.Attributes)})
+	case fileDeleteNode:
+		b.nodes.memoryNodes.Delete(r.Key)
+	case fileAddEdgeNode:
+		b.edges(r.Kind).memoryEdges.AddNode(r.ID)
+	case fileRemoveEdgeNode:
+		b.edges(r.Kind).memoryEdges.RemoveNode(r.ID)
+	case fileSetEdge:
+		b.edges(r.Kind).memoryEdges.Set(r.From, r.To, r.Attributes)
+	case fileRemoveEdge:
+		b.edges(r.Kind).memoryEdges.Remove(r.From, r.To)
+	}
+	return nil
+}
+
+func (b *FileBackend) edges(kind EdgeKind) *fileEdges {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	e, has := b.kinds[kind]
+	if !has {
+		e = &fileEdges{memoryEdges: newMemoryEdges(), kind: kind, backend: b}
+		b.kinds[kind] = e
+	}
+	return e
+}
+
+// write appends the record to the file.  The first error is kept for Sync and Close, and
+// the file is not written after it.
+func (b *FileBackend) write(r fileRecord) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.err == nil {
+		b.err = writeFrame(b.file, r)
+	}
+}
+
+func (b *FileBackend) fail(err error) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// NodeStore returns the store of the nodes, loaded from the file.
+func (b *FileBackend) NodeStore() NodeStore {
+	return b.nodes
+}
+
+// EdgeStore returns the store of the edges of the kind, loaded from the file.  It is the
+// same store for a kind each time.
+func (b *FileBackend) EdgeStore(kind EdgeKind) EdgeStore {
+	return b.edges(kind)
+}
+
+// Kinds returns the kinds in the file.
+func (b *FileBackend) Kinds() []EdgeKind {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	kinds := make([]EdgeKind, 0, len(b.kinds))
+	for kind := range b.kinds {
+		kinds = append(kinds, kind)
+	}
+	sortKinds(kinds)
+	return kinds
+}
+
+// Persistent is true.
+func (b *FileBackend) Persistent() bool {
+	return true
+}
+
+// Sync commits the file to disk and returns the first error writing it.
+func (b *FileBackend) Sync() error {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.err != nil {
+		return b.err
+	}
+	return b.file.Sync()
+}
+
+// Close syncs and closes the file.
+func (b *FileBackend) Close() error {
+	err := b.Sync()
+	if cerr := b.file.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// fileNodes is the store of the nodes of a FileBackend.
+type fileNodes struct {
+	*memoryNodes
+	backend *FileBackend
+}
+
+func (f *fileNodes) Put(n StoredNode) {
+	f.memoryNodes.Put(n)
+	buff, err := f.backend.codec.EncodeNode(n.Node)
+	if err != nil {
+		f.backend.fail(err)
+		return
+	}
+	attrs := attributeList(n.Attributes)
+	sort.Slice(attrs, func(i, j int) bool { return attrs[i].Key < attrs[j].Key })
+	f.backend.write(fileRecord{Op: filePutNode, Node: buff, ID: n.ID, Attributes: attrs})
+}
+
+func (f *fileNodes) Delete(key NodeKey) {
+	f.backend.write(fileRecord{Op: fileDeleteNode, Key: key})
+	f.memoryNodes.Delete(key)
+}
+
+// fileEdges is the store of the edges of a kind of a FileBackend.
+type fileEdges struct {
+	*memoryEdges
+	kind    EdgeKind
+	backend *FileBackend
+}
+
+func (f *fileEdges) AddNode(id int64) {
+	if !f.HasNode(id) {
+		f.backend.write(fileRecord{Op: fileAddEdgeNode, Kind: f.kind, ID: id})
+		f.memoryEdges.AddNode(id)
+	}
+}
+
+func (f *fileEdges) RemoveNode(id int64) {
+	f.backend.write(fileRecord{Op: fileRemoveEdgeNode, Kind: f.kind, ID: id})
+	f.memoryEdges.RemoveNode(id)
+}
+
+func (f *fileEdges) Set(from, to int64, attrs []Attribute) {
+	f.backend.write(fileRecord{Op: fileSetEdge, Kind: f.kind, From: from, To: to, Attributes: attrs})
+	f.memoryEdges.Set(from, to, attrs)
+}
+
+func (f *fileEdges) Remove(from, to int64) {
+	f.backend.write(fileRecord{Op: fileRemoveEdge, Kind: f.kind, From: from, To: to})
+	f.memoryEdges.Remove(from, to)
+}
@@ -0,0 +1,183 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// countingBackend is a backend that counts the edge stores it makes.
+type countingBackend struct {
+	MemoryBackend
+	kinds []EdgeKind
+}
+
+func (b *countingBackend) EdgeStore(kind EdgeKind) EdgeStore {
+	b.kinds = append(b.kinds, kind)
+	return b.MemoryBackend.EdgeStore(kind)
+}
+
+func TestBackend(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+
+	backend := &countingBackend{}
+	g := Builder(Options{Backend: backend})
+	require.NoError(t, g.Add(A, B, C))
+
+	calls := EdgeKind("calls")
+	g.Associate(A, calls, B)
+	g.Associate(B, calls, C)
+	require.Equal(t, []EdgeKind{calls}, backend.kinds)
+
+	sorted, err := DirectedSort(g, calls)
+	require.NoError(t, err)
+	require.Equal(t, []Node{A, B, C}, sorted)
+	require.Equal(t, NodeSlice{B}, g.From(A, calls).Nodes().Slice())
+
+	// Snapshots copy the stores instead of making new ones
+	snapshot, err := Snapshot(g)
+	require.NoError(t, err)
+	require.NoError(t, g.Disassociate(A, calls, B))
+	require.NotNil(t, snapshot.Edge(A, calls, B))
+	require.Nil(t, g.Edge(A, calls, B))
+	require.Equal(t, []EdgeKind{calls}, backend.kinds)
+}
+
+// copyingBackend keeps the attributes of the edges as a store outside memory would: it
+// returns a copy of them each time.
+type copyingBackend struct {
+	MemoryBackend
+}
+
+func (b copyingBackend) EdgeStore(kind EdgeKind) EdgeStore {
+	return copyingEdges{b.MemoryBackend.EdgeStore(kind)}
+}
+
+type copyingEdges struct {
+	EdgeStore
+}
+
+func (c copyingEdges) Get(from, to int64) ([]Attribute, bool) {
+	attrs, has := c.EdgeStore.Get(from, to)
+	return append([]Attribute{}, attrs...), has
+}
+
+func (c copyingEdges) Copy() EdgeStore {
+	return copyingEdges{c.EdgeStore.Copy()}
+}
+
+func TestBackendEdges(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+
+	g := Builder(Options{Backend: copyingBackend{}})
+	require.NoError(t, g.Add(A, B, C))
+
+	calls := EdgeKind("calls")
+	g.Associate(A, calls, B, Attribute{Key: "rate", Value: 2})
+	g.Associate(B, calls, C, Attribute{Key: "rate", Value: 1})
+
+	require.True(t, g.Edge(A, calls, B) == g.Edge(A, calls, B))
+	require.Equal(t, 2, g.From(A, calls).Edges().Slice()[0].Attributes()["rate"])
+	require.Equal(t, NodeSlice{A}, g.To(calls, B).Nodes().Slice())
+
+	paths, err := KShortestPaths(g, calls, A, C, 1, EdgeAttributeWeight("rate", 1))
+	require.NoError(t, err)
+	require.Equal(t, []Path{{A, B, C}}, paths)
+
+	frozen, err := Freeze(g)
+	require.NoError(t, err)
+	require.Equal(t, 1, frozen.Edge(B, calls, C).Attributes()["rate"])
+
+	union, err := Union(g, g, AlgebraOptions{})
+	require.NoError(t, err)
+	require.Equal(t, 2, union.Edge(union.Node("A"), calls, union.Node("B")).Attributes()["rate"])
+
+	require.NoError(t, g.Disassociate(A, calls, B))
+	require.Nil(t, g.Edge(A, calls, B))
+}
+
+func TestFileBackend(t *testing.T) {
+
+	dir, err := ioutil.TempDir("", "xgraph")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "graph")
+	calls := EdgeKind("calls")
+	open := func() (*FileBackend, GraphBuilder) {
+		backend, err := OpenFile(path, "nodeT")
+		require.NoError(t, err)
+		return backend, Builder(Options{Backend: backend, NodeIndexes: []string{"team"}, Acyclic: []EdgeKind{calls}})
+	}
+
+	backend, g := open()
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	require.NoError(t, g.Add(A, B, C))
+	g.Associate(A, calls, B, Attribute{Key: "rate", Value: 1})
+	g.Associate(B, calls, C)
+	require.NoError(t, SetAttributes(g, B, Attribute{Key: "team", Value: "web"}))
+	require.NoError(t, backend.Close())
+
+	backend, g = open()
+	require.Equal(t, 1, g.Edge(g.Node("A"), calls, g.Node("B")).Attributes()["rate"])
+	require.Equal(t, NodeSlice{g.Node("B")}, g.(Indexer).NodesByAttribute("team", "web"))
+	sorted, err := DirectedSort(g, calls)
+	require.NoError(t, err)
+	require.Equal(t, []string{"A", "B", "C"}, keys(sorted))
+	_, err = g.Associate(g.Node("C"), calls, g.Node("A"))
+	require.IsType(t, ErrCycle{}, err)
+
+	// Snapshots, clones and failed batches do not change the file
+	clone, err := Clone(g)
+	require.NoError(t, err)
+	require.NoError(t, clone.Add(&nodeT{id: "E"}))
+	require.Error(t, g.Batch(func(tx GraphBuilder) error {
+		require.NoError(t, tx.Add(&nodeT{id: "F"}))
+		return tx.Remove(&nodeT{id: "A"})
+	}))
+	require.NoError(t, g.Batch(func(tx GraphBuilder) error {
+		if err := tx.Add(&nodeT{id: "D"}); err != nil {
+			return err
+		}
+		_, err := tx.Associate(tx.Node("D"), calls, tx.Node("A"))
+		return err
+	}))
+	require.NoError(t, g.Remove(g.Node("C")))
+	require.NoError(t, backend.Close())
+
+	// A change cut short by a crash is dropped, and the file is appended after it.
+	// Removing C disassociated B -> C before removing C.
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NoError(t, os.Truncate(path, info.Size()-2))
+
+	backend, g = open()
+	require.NotNil(t, g.Node("C"))
+	require.Nil(t, g.Edge(g.Node("B"), calls, g.Node("C")))
+	require.Nil(t, g.Node("E"))
+	require.Nil(t, g.Node("F"))
+	require.Equal(t, NodeSlice{g.Node("A")}, g.From(g.Node("D"), calls).Nodes().Slice())
+	require.NoError(t, g.Add(&nodeT{id: "G"}))
+	g.Associate(g.Node("G"), calls, g.Node("D"))
+	require.NoError(t, backend.Close())
+
+	backend, g = open()
+	sorted, err = DirectedSort(g, calls)
+	require.NoError(t, err)
+	require.Equal(t, []string{"G", "D", "A", "B"}, keys(sorted))
+	require.NoError(t, backend.Close())
+
+	_, err = OpenFile(path, "unknown")
+	require.Error(t, err)
+}
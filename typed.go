@@ -0,0 +1,170 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+// TypedBuilder is a graph of nodes of type N with keys of type K, checked at compile time.
+// It is layered over a GraphBuilder, which Untyped returns for the functions of the package.
+// Add rejects nodes whose keys, as returned by NodeKey, are not of type K.
+type TypedBuilder[K comparable, N Node] struct {
+	g GraphBuilder
+}
+
+// NewTypedBuilder returns an empty typed graph.
+func NewTypedBuilder[K comparable, N Node](options Options) *TypedBuilder[K, N] {
+	return &TypedBuilder[K, N]{g: Builder(options)}
+}
+
+// Kind is an edge kind between nodes of type N.
+type Kind[N Node] struct {
+	kind EdgeKind
+}
+
+// NewKind returns the kind for edges between nodes of type N.
+func NewKind[N Node](kind EdgeKind) Kind[N] {
+	return Kind[N]{kind: kind}
+}
+
+// EdgeKind returns the untyped kind.
+func (k Kind[N]) EdgeKind() EdgeKind {
+	return k.kind
+}
+
+// TypedEdge is an edge between nodes of type N.  From and To are false for a node of
+// another type, added through Untyped.
+type TypedEdge[N Node] struct {
+	Edge
+}
+
+func (e TypedEdge[N]) From() (N, bool) {
+	n, ok := e.Edge.From().(N)
+	return n, ok
+}
+
+func (e TypedEdge[N]) To() (N, bool) {
+	n, ok := e.Edge.To().(N)
+	return n, ok
+}
+
+// AttributeKey is the key of an attribute whose values are of type V.
+type AttributeKey[V any] string
+
+// Value returns the attribute of the key with the value.
+func (k AttributeKey[V]) Value(v V) Attribute {
+	return Attribute{Key: string(k), Value: v}
+}
+
+// Of returns the value of the attribute of a node or an edge, or false if it has none of
+// type V.
+func (k AttributeKey[V]) Of(a Attributer) (V, bool) {
+	v, ok := a.Attributes()[string(k)].(V)
+	return v, ok
+}
+
+// Untyped returns the graph for the untyped functions of the package.
+func (b *TypedBuilder[K, N]) Untyped() GraphBuilder {
+	return b.g
+}
+
+func (b *TypedBuilder[K, N]) Add(n N, other ...N) error {
+	all := make([]Node, len(other))
+	for i := range other {
+		all[i] = other[i]
+	}
+	for _, check := range append([]Node{n}, all...) {
+		if _, is := check.NodeKey().(K); !is {
+			return ErrKeyType{check}
+		}
+	}
+	return b.g.Add(n, all...)
+}
+
+func (b *TypedBuilder[K, N]) Remove(n N) error {
+	return b.g.Remove(n)
+}
+
+// Node returns the node of the key, or false.
+func (b *TypedBuilder[K, N]) Node(key K) (N, bool) {
+	n, ok := b.g.Node(key).(N)
+	return n, ok
+}
+
+func (b *TypedBuilder[K, N]) Associate(from N, kind Kind[N], to N, attrs ...Attribute) (TypedEdge[N], error) {
+	e, err := b.g.Associate(from, kind.kind, to, attrs...)
+	if err != nil {
+		return TypedEdge[N]{}, err
+	}
+	return TypedEdge[N]{Edge: e}, nil
+}
+
+func (b *TypedBuilder[K, N]) Disassociate(from N, kind Kind[N], to N) error {
+	return b.g.Disassociate(from, kind.kind, to)
+}
+
+// Edge returns the edge of the kind from -> to, or false.
+func (b *TypedBuilder[K, N]) Edge(from N, kind Kind[N], to N) (TypedEdge[N], bool) {
+	e := b.g.Edge(from, kind.kind, to)
+	if e == nil {
+		return TypedEdge[N]{}, false
+	}
+	return TypedEdge[N]{Edge: e}, true
+}
+
+// From returns the nodes the edges of the kind from the node go to.  Here and in the methods
+// below, nodes of other types than N are skipped.
+func (b *TypedBuilder[K, N]) From(from N, kind Kind[N]) []N {
+	return typedNodes[N](b.g.From(from, kind.kind).Nodes())
+}
+
+// To returns the nodes the edges of the kind to the node come from.
+func (b *TypedBuilder[K, N]) To(kind Kind[N], to N) []N {
+	return typedNodes[N](b.g.To(kind.kind, to).Nodes())
+}
+
+// EdgesFrom returns the edges of the kind from the node.
+func (b *TypedBuilder[K, N]) EdgesFrom(from N, kind Kind[N]) []TypedEdge[N] {
+	return typedEdges[N](b.g.From(from, kind.kind).Edges())
+}
+
+// EdgesTo returns the edges of the kind to the node.
+func (b *TypedBuilder[K, N]) EdgesTo(kind Kind[N], to N) []TypedEdge[N] {
+	return typedEdges[N](b.g.To(kind.kind, to).Edges())
+}
+
+// DirectedSort sorts the nodes of the kind topologically, like DirectedSort.  It fails with
+// ErrNodeType if the kind has a node of another type than N, which cannot be left out of
+// the order.
+func (b *TypedBuilder[K, N]) DirectedSort(kind Kind[N]) ([]N, error) {
+	sorted, err := DirectedSort(b.g, kind.kind)
+	if err != nil {
+		return nil, err
+	}
+	out := make([]N, len(sorted))
+	for i := range sorted {
+		n, ok := sorted[i].(N)
+		if !ok {
+			return nil, ErrNodeType{sorted[i]}
+		}
+		out[i] = n
+	}
+	return out, nil
+}
+
+func typedNodes[N Node](nodes Nodes) []N {
+	out := []N{}
+	for n := range nodes {
+		if typed, ok := n.(N); ok {
+			out = append(out, typed)
+		}
+	}
+	return out
+}
+
+func typedEdges[N Node](edges Edges) []TypedEdge[N] {
+	out := []TypedEdge[N]{}
+	for e := range edges {
+		_, from := e.From().(N)
+		_, to := e.To().(N)
+		if from && to {
+			out = append(out, TypedEdge[N]{Edge: e})
+		}
+	}
+	return out
+}
@@ -0,0 +1,113 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTypedBuilder(t *testing.T) {
+
+	A := &nodeT{id: "A", attributes: map[string]interface{}{"team": "web"}}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+
+	g := NewTypedBuilder[string, *nodeT](Options{})
+	require.NoError(t, g.Add(A, B, C))
+
+	n, ok := g.Node("A")
+	require.True(t, ok)
+	require.Equal(t, A, n)
+	_, ok = g.Node("D")
+	require.False(t, ok)
+
+	calls := NewKind[*nodeT]("calls")
+	rate := AttributeKey[int]("rate")
+
+	e, err := g.Associate(A, calls, B, rate.Value(2))
+	require.NoError(t, err)
+	from, ok := e.From()
+	require.True(t, ok)
+	require.Equal(t, A, from)
+	to, ok := e.To()
+	require.True(t, ok)
+	require.Equal(t, B, to)
+	_, err = g.Associate(B, calls, C)
+	require.NoError(t, err)
+
+	v, ok := rate.Of(e)
+	require.True(t, ok)
+	require.Equal(t, 2, v)
+	_, ok = AttributeKey[string]("rate").Of(e)
+	require.False(t, ok)
+
+	team, ok := AttributeKey[string]("team").Of(A)
+	require.True(t, ok)
+	require.Equal(t, "web", team)
+
+	require.Equal(t, []*nodeT{B}, g.From(A, calls))
+	require.Equal(t, []*nodeT{A}, g.To(calls, B))
+	require.Equal(t, []*nodeT{}, g.From(C, calls))
+	to, _ = g.EdgesFrom(A, calls)[0].To()
+	require.Equal(t, B, to)
+	from, _ = g.EdgesTo(calls, C)[0].From()
+	require.Equal(t, B, from)
+
+	sorted, err := g.DirectedSort(calls)
+	require.NoError(t, err)
+	require.Equal(t, []*nodeT{A, B, C}, sorted)
+
+	// The untyped graph is the same graph
+	require.Equal(t, A, g.Untyped().Edge(A, calls.EdgeKind(), B).From())
+	exists, err := PathExistsIn(g.Untyped(), calls.EdgeKind(), A, C)
+	require.NoError(t, err)
+	require.True(t, exists)
+
+	require.NoError(t, g.Disassociate(A, calls, B))
+	_, ok = g.Edge(A, calls, B)
+	require.False(t, ok)
+	_, ok = g.Edge(B, calls, C)
+	require.True(t, ok)
+
+	require.NoError(t, g.Remove(C))
+	_, ok = g.Node("C")
+	require.False(t, ok)
+}
+
+func TestTypedBuilderForeignNodes(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	X := &teamT{&nodeT{id: "X"}}
+
+	g := NewTypedBuilder[string, *nodeT](Options{})
+	require.NoError(t, g.Add(A, B))
+	calls := NewKind[*nodeT]("calls")
+	_, err := g.Associate(A, calls, B)
+	require.NoError(t, err)
+
+	// A node of another type added through the untyped graph
+	require.NoError(t, g.Untyped().Add(X))
+	e, err := g.Untyped().Associate(A, calls.EdgeKind(), X)
+	require.NoError(t, err)
+
+	_, ok := TypedEdge[*nodeT]{Edge: e}.To()
+	require.False(t, ok)
+	require.Equal(t, []*nodeT{B}, g.From(A, calls))
+	require.Equal(t, 1, len(g.EdgesFrom(A, calls)))
+
+	_, err = g.DirectedSort(calls)
+	require.Equal(t, ErrNodeType{X}, err)
+}
+
+func TestTypedBuilderKeyType(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+
+	// The keys of nodeT are strings, so no node can be added to a graph with int keys
+	g := NewTypedBuilder[int, *nodeT](Options{})
+	require.Equal(t, ErrKeyType{A}, g.Add(A))
+	require.Equal(t, ErrKeyType{B}, g.Add(B, A))
+	require.Nil(t, g.Untyped().Node("B"))
+}
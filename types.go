@@ -1,5 +1,10 @@
 package xgraph // import "github.com/orkestr8/xgraph"
 
+import (
+	"fmt"
+	"strings"
+)
+
 type NodeKey interface{}
 type NodeKeyer interface {
 	NodeKey() NodeKey
@@ -9,6 +14,12 @@ type Attributer interface {
 	Attributes() map[string]interface{}
 }
 
+// AttributeSetter is implemented by nodes whose attributes can be changed with SetAttributes.
+type AttributeSetter interface {
+	Attributer
+	SetAttributes(...Attribute)
+}
+
 type OperatorFunc func([]interface{}) (interface{}, error)
 
 type Operator interface {
@@ -21,6 +32,14 @@ type Node interface {
 
 type Path []Node
 
+func (p Path) String() string {
+	keys := make([]string, len(p))
+	for i := range p {
+		keys[i] = fmt.Sprintf("%v", p[i].NodeKey())
+	}
+	return strings.Join(keys, " -> ")
+}
+
 type EdgeKind interface{}
 
 type Edge interface {
@@ -34,6 +53,40 @@ type Options struct {
 
 	// NodeIDOffset is the base to increment node id from.
 	NodeIDOffset int64
+
+	// NodeIndexes are the node attribute keys to keep secondary indexes for.
+	NodeIndexes []string
+
+	// EdgeIndexes are the edge attribute keys to keep secondary indexes for.  Each EdgeKind
+	// keeps its own indexes of these keys.
+	EdgeIndexes []string
+
+	// Schema, if set, is enforced by Add and Associate.
+	Schema *Schema
+
+	// Acyclic are the kinds where Associate rejects edges that close a cycle.
+	// This is in addition to the kinds marked Acyclic in the Schema.
+	Acyclic []EdgeKind
+
+	// Backend stores the nodes and edges.  MemoryBackend if nil.
+	Backend Backend
+
+	// Versioned graphs keep every version of their nodes and edges for AsOf.
+	Versioned bool
+
+	// EventQueue is the most events queued for an observer while it is busy.  Further
+	// events are dropped, and the next event it gets counts them in Dropped.  No limit if 0.
+	EventQueue int
+
+	// Reachability are the kinds where PathExistsIn uses a reachability index.  The index
+	// is built on the first query and again after changes that may change the paths.
+	Reachability []EdgeKind
+
+	// Attributes are the attributes of the graph, like its name, version or owner.
+	Attributes []Attribute
+
+	// Kinds describe the edge kinds.
+	Kinds map[EdgeKind]KindDescriptor
 }
 
 type Attribute struct {
@@ -45,6 +98,18 @@ type GraphBuilder interface {
 	Graph
 	Add(Node, ...Node) error
 	Associate(from Node, kind EdgeKind, to Node, attributes ...Attribute) (Edge, error)
+	Disassociate(from Node, kind EdgeKind, to Node) error
+
+	// Remove removes a node and its edges.
+	Remove(Node) error
+
+	// Subscribe adds an observer of the changes to the graph and returns the function that
+	// removes it.
+	Subscribe(Observer) (cancel func())
+
+	// Batch calls the function with a transaction and applies all its changes to the graph
+	// at once, or none if the function or any change fails.
+	Batch(func(tx GraphBuilder) error) error
 }
 
 type Nodes <-chan Node
@@ -64,7 +129,26 @@ type NodesOrEdges interface {
 	Edges(...func(Edge) bool) Edges
 }
 
+// Indexer looks up nodes and edges by their attribute values.  Lookups on keys
+// listed in Options.NodeIndexes / Options.EdgeIndexes use the secondary indexes;
+// other keys fall back to a scan.  Range lookups match values in the closed interval
+// [min, max] and a nil bound is open.  Numbers, strings and time.Time are ordered.
+// The graphs of Builder implement it; use a type assertion to check others.
+type Indexer interface {
+	NodesByAttribute(key string, value interface{}) NodeSlice
+	NodesByAttributeRange(key string, min, max interface{}) NodeSlice
+	EdgesByAttribute(kind EdgeKind, key string, value interface{}) EdgeSlice
+	EdgesByAttributeRange(kind EdgeKind, key string, min, max interface{}) EdgeSlice
+}
+
 type Graph interface {
+
+	// Attributes returns the attributes of the graph.
+	Attributer
+
+	// Descriptor returns the descriptor of the kind, or false.
+	Descriptor(EdgeKind) (KindDescriptor, bool)
+
 	Node(NodeKey) Node
 	Edge(from Node, kind EdgeKind, to Node) Edge
 	To(EdgeKind, Node) NodesOrEdges
@@ -96,6 +180,13 @@ type DotOptions struct {
 	EdgeColors   map[EdgeKind]EdgeColor
 	EdgeLabelers map[Edge]EdgeLabeler
 	NodeLabelers map[Node]NodeLabeler
+
+	// Clusters groups the nodes into clusters by label, for example Communities.DotClusters.
+	Clusters map[Node]string
+
+	// NodeAttributes and EdgeAttributes are extra dot attributes of nodes and edges.
+	NodeAttributes map[Node]map[string]string
+	EdgeAttributes map[Edge]map[string]string
 }
 
 type EdgeLabeler func(Edge) string
@@ -0,0 +1,305 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"sort"
+	"time"
+)
+
+// Version numbers the states of a versioned graph: version v is the graph after its v-th
+// change, the change with Event.Sequence v.  Version 0 is the empty graph.
+type Version uint64
+
+// NodeVersion is a node with its attributes from ValidFrom to ValidTo, excluded.  ValidTo is
+// 0 while the version is current.
+type NodeVersion struct {
+	Node       Node
+	Attributes map[string]interface{}
+	ValidFrom  Version
+	ValidTo    Version
+}
+
+// EdgeVersion is an edge from ValidFrom to ValidTo, excluded.  ValidTo is 0 while the
+// version is current.
+type EdgeVersion struct {
+	Edge      Edge
+	ValidFrom Version
+	ValidTo   Version
+}
+
+func (v Version) in(from, to Version) bool {
+	return from <= v && (to == 0 || v < to)
+}
+
+// history keeps every version of the nodes and edges of a graph, and the change of each
+// version.  Versions are not changed once recorded, so snapshots and clones share the
+// history of their graph: a graph records in a copy of the maps of a shared history.
+type history struct {
+	nodes   map[interface{}][]*NodeVersion
+	edges   map[EdgeKind]map[edgeKey][]*EdgeVersion
+	changes []*change // the change of version v is at v-1
+	shared  bool
+}
+
+// change is the event of a version, with the time it was recorded and, for the node events
+// but NodeRemoved, the attributes of the node version it made.
+type change struct {
+	Event
+	at         time.Time
+	attributes map[string]interface{}
+}
+
+func newHistory() *history {
+	return &history{
+		nodes: map[interface{}][]*NodeVersion{},
+		edges: map[EdgeKind]map[edgeKey][]*EdgeVersion{},
+	}
+}
+
+// share marks the history shared.  It is not marked again, as other graphs may read it.
+func (h *history) share() *history {
+	if !h.shared {
+		h.shared = true
+	}
+	return h
+}
+
+// owned returns the history itself, or a copy of its maps if it is shared.
+func (h *history) owned() *history {
+	if !h.shared {
+		return h
+	}
+	c := newHistory()
+	c.changes = append(make([]*change, 0, len(h.changes)+1), h.changes...)
+	for key, versions := range h.nodes {
+		c.nodes[key] = versions
+	}
+	for kind, edges := range h.edges {
+		c.edges[kind] = make(map[edgeKey][]*EdgeVersion, len(edges))
+		for key, versions := range edges {
+			c.edges[kind][key] = versions
+		}
+	}
+	return c
+}
+
+// record adds the versions of the change.  The versions of a key are copied first, as the
+// old slice may be shared.
+func (h *history) record(e Event) {
+	v := Version(e.Sequence)
+	c := &change{Event: e, at: time.Now()}
+	h.changes = append(h.changes, c)
+	switch e.Type {
+	case NodeAdded, NodeChanged, NodeRemoved:
+		key := e.Node.NodeKey()
+		versions := append([]*NodeVersion{}, h.nodes[key]...)
+		if e.Type != NodeAdded && len(versions) > 0 {
+			last := *versions[len(versions)-1]
+			last.ValidTo = v
+			versions[len(versions)-1] = &last
+		}
+		if e.Type != NodeRemoved {
+			c.attributes = copyAttributes(nodeAttributes(e.Node))
+			versions = append(versions, &NodeVersion{Node: e.Node, Attributes: c.attributes, ValidFrom: v})
+		}
+		h.nodes[key] = versions
+	default:
+		kind := e.Edge.Kind()
+		if h.edges[kind] == nil {
+			h.edges[kind] = map[edgeKey][]*EdgeVersion{}
+		}
+		key := edgeKey{e.Edge.From().NodeKey(), e.Edge.To().NodeKey()}
+		versions := append([]*EdgeVersion{}, h.edges[kind][key]...)
+		if e.Type != EdgeAssociated && len(versions) > 0 {
+			last := *versions[len(versions)-1]
+			last.ValidTo = v
+			versions[len(versions)-1] = &last
+		}
+		if e.Type != EdgeDisassociated {
+			versions = append(versions, &EdgeVersion{Edge: e.Edge, ValidFrom: v})
+		}
+		h.edges[kind][key] = versions
+	}
+}
+
+// versioned returns the history of the graph, or ErrNotSupported if it is not versioned.
+func versioned(g Graph) (*graph, error) {
+	xg, ok := g.(*graph)
+	if !ok || xg.observers.history == nil {
+		return nil, ErrNotSupported{g}
+	}
+	return xg, nil
+}
+
+// CurrentVersion returns the version of a graph built with Options.Versioned.
+func CurrentVersion(g Graph) (Version, error) {
+	xg, err := versioned(g)
+	if err != nil {
+		return 0, err
+	}
+	xg.observers.lock.Lock()
+	defer xg.observers.lock.Unlock()
+	return Version(xg.observers.sequence), nil
+}
+
+// NodeHistory returns the versions of the node of the key, oldest first.
+func NodeHistory(g Graph, key NodeKey) ([]NodeVersion, error) {
+	xg, err := versioned(g)
+	if err != nil {
+		return nil, err
+	}
+	xg.observers.lock.Lock()
+	defer xg.observers.lock.Unlock()
+
+	out := []NodeVersion{}
+	for _, nv := range xg.observers.history.nodes[key] {
+		out = append(out, *nv)
+	}
+	return out, nil
+}
+
+// EdgeHistory returns the versions of the edge of the kind between the nodes of the keys,
+// oldest first.
+func EdgeHistory(g Graph, from NodeKey, kind EdgeKind, to NodeKey) ([]EdgeVersion, error) {
+	xg, err := versioned(g)
+	if err != nil {
+		return nil, err
+	}
+	xg.observers.lock.Lock()
+	defer xg.observers.lock.Unlock()
+
+	out := []EdgeVersion{}
+	for _, ev := range xg.observers.history.edges[kind][edgeKey{from, to}] {
+		out = append(out, *ev)
+	}
+	return out, nil
+}
+
+// VersionAt returns the version a versioned graph had at the time: the version of the last
+// change made at or before it, or 0 if the graph was not changed yet.
+func VersionAt(g Graph, t time.Time) (Version, error) {
+	xg, err := versioned(g)
+	if err != nil {
+		return 0, err
+	}
+	xg.observers.lock.Lock()
+	defer xg.observers.lock.Unlock()
+
+	changes := xg.observers.history.changes
+	return Version(sort.Search(len(changes), func(i int) bool { return changes[i].at.After(t) })), nil
+}
+
+// VersionTime returns the time the change of the version was made.
+func VersionTime(g Graph, version Version) (time.Time, error) {
+	xg, err := versioned(g)
+	if err != nil {
+		return time.Time{}, err
+	}
+	xg.observers.lock.Lock()
+	defer xg.observers.lock.Unlock()
+
+	if version == 0 || version > Version(len(xg.observers.history.changes)) {
+		return time.Time{}, ErrNoVersion{Version: version}
+	}
+	return xg.observers.history.changes[version-1].at, nil
+}
+
+// AsOf returns the graph as it was at the version, read only.  Its nodes are the values
+// added to the graph, and NodeAttributes returns the attributes of the version.  The
+// Schema and Acyclic kinds of the graph are not checked again.  The graph is built from
+// the closest earlier version built by AsOf, by making the changes since.
+func AsOf(g Graph, version Version) (Graph, error) {
+	xg, err := versioned(g)
+	if err != nil {
+		return nil, err
+	}
+
+	o := xg.observers
+	o.lock.Lock()
+	if version > Version(o.sequence) {
+		o.lock.Unlock()
+		return nil, ErrNoVersion{Version: version}
+	}
+	var base *pastGraph
+	for _, p := range o.pasts {
+		if p.version <= version && (base == nil || p.version > base.version) {
+			base = p
+		}
+	}
+	if base != nil && base.version == version {
+		o.lock.Unlock()
+		return base.graph, nil
+	}
+	from := Version(0)
+	if base != nil {
+		from = base.version
+	}
+	// The changes recorded are not changed, so they are read without the lock.
+	changes := o.history.changes[from:version]
+	o.lock.Unlock()
+
+	var past *graph
+	if base == nil {
+		options := xg.Options
+		options.Backend = nil
+		options.Versioned = false
+		options.Schema = nil
+		options.Acyclic = nil
+		past = newGraph(options)
+	} else {
+		past = base.graph.share(false)
+	}
+	for _, c := range changes {
+		if err := past.apply(c); err != nil {
+			return nil, err
+		}
+	}
+	past.readOnly = true
+
+	o.lock.Lock()
+	defer o.lock.Unlock()
+	o.pasts = append(o.pasts, &pastGraph{version: version, graph: past})
+	if len(o.pasts) > maxPasts {
+		o.pasts = o.pasts[1:]
+	}
+	return past, nil
+}
+
+// maxPasts is the number of graphs built by AsOf kept to build other versions from.
+const maxPasts = 8
+
+// pastGraph is a graph built by AsOf.
+type pastGraph struct {
+	version Version
+	graph   *graph
+}
+
+// apply makes a recorded change to a graph built by AsOf.
+func (g *graph) apply(c *change) error {
+	switch c.Type {
+	case NodeAdded:
+		if err := g.Add(c.Node); err != nil {
+			return err
+		}
+		g.restoreAttributes(c.Node, attributeList(c.attributes))
+	case NodeChanged:
+		g.restoreAttributes(c.Node, attributeList(c.attributes))
+	case NodeRemoved:
+		return g.Remove(c.Node)
+	case EdgeAssociated, EdgeChanged:
+		from, to := g.Node(c.Edge.From().NodeKey()), g.Node(c.Edge.To().NodeKey())
+		_, err := g.Associate(from, c.Edge.Kind(), to, edgeAttributes(c.Edge)...)
+		return err
+	case EdgeDisassociated:
+		from, to := g.Node(c.Edge.From().NodeKey()), g.Node(c.Edge.To().NodeKey())
+		return g.Disassociate(from, c.Edge.Kind(), to)
+	}
+	return nil
+}
+
+func attributeList(attrs map[string]interface{}) []Attribute {
+	list := make([]Attribute, 0, len(attrs))
+	for k, v := range attrs {
+		list = append(list, Attribute{Key: k, Value: v})
+	}
+	return list
+}
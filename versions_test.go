@@ -0,0 +1,225 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestAsOf(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	C := &nodeT{id: "C"}
+	dependsOn := EdgeKind("dependsOn")
+
+	_, err := AsOf(Builder(Options{}), 0)
+	require.Error(t, err)
+
+	g := Builder(Options{Versioned: true})
+	require.NoError(t, g.Add(A, B, C))
+	g.Associate(A, dependsOn, B)
+	g.Associate(B, dependsOn, C)
+
+	v1, err := CurrentVersion(g)
+	require.NoError(t, err)
+	require.Equal(t, Version(5), v1)
+
+	g.Associate(A, dependsOn, B, Attribute{Key: "pinned", Value: true})
+	require.NoError(t, g.Disassociate(B, dependsOn, C))
+	g.Associate(C, dependsOn, A)
+	require.NoError(t, SetAttributes(g, B, Attribute{Key: "team", Value: "web"}))
+
+	_, err = AsOf(g, 100)
+	require.Equal(t, ErrNoVersion{Version: 100}, err)
+
+	past, err := AsOf(g, v1)
+	require.NoError(t, err)
+	require.Equal(t, []string{"B"}, keys(past.From(A, dependsOn).Nodes().Slice()))
+	require.Equal(t, []string{"B"}, keys(past.To(dependsOn, C).Nodes().Slice()))
+	require.Nil(t, past.Edge(A, dependsOn, B).Attributes()["pinned"])
+	sorted, err := DirectedSort(past, dependsOn)
+	require.NoError(t, err)
+	require.Equal(t, []string{"A", "B", "C"}, keys(sorted))
+	dot, err := EncodeDot(past, DotOptions{})
+	require.NoError(t, err)
+	require.Contains(t, string(dot), "B -> C")
+
+	err = past.(GraphBuilder).Add(&nodeT{id: "D"})
+	require.Equal(t, ErrReadOnly{}, err)
+
+	now, err := AsOf(g, v1+4)
+	require.NoError(t, err)
+	require.Equal(t, true, now.Edge(A, dependsOn, B).Attributes()["pinned"])
+	require.Nil(t, now.Edge(B, dependsOn, C))
+	sorted, err = DirectedSort(now, dependsOn)
+	require.NoError(t, err)
+	require.Equal(t, []string{"C", "A", "B"}, keys(sorted))
+
+	empty, err := AsOf(g, 0)
+	require.NoError(t, err)
+	require.Nil(t, empty.Node("A"))
+
+	// Removed nodes are in the versions before their removal
+	require.NoError(t, g.Remove(C))
+	require.Nil(t, g.Node("C"))
+	past, err = AsOf(g, v1)
+	require.NoError(t, err)
+	require.Equal(t, "C", past.Node("C").NodeKey())
+
+	history, err := NodeHistory(g, "B")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(history))
+	require.Nil(t, history[0].Attributes["team"])
+	require.Equal(t, "web", history[1].Attributes["team"])
+	require.Equal(t, history[0].ValidTo, history[1].ValidFrom)
+	require.Equal(t, Version(0), history[1].ValidTo)
+
+	edges, err := EdgeHistory(g, "A", dependsOn, "B")
+	require.NoError(t, err)
+	require.Equal(t, 2, len(edges))
+	require.Equal(t, Version(4), edges[0].ValidFrom)
+
+	// Snapshots keep the history
+	snapshot, err := Snapshot(g)
+	require.NoError(t, err)
+	past, err = AsOf(snapshot, v1)
+	require.NoError(t, err)
+	require.NotNil(t, past.Edge(B, dependsOn, C))
+}
+
+func TestAsOfAttributes(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	calls := EdgeKind("calls")
+
+	schema := &Schema{Nodes: []NodeMatcher{NodeOfType(A)}}
+	g := Builder(Options{Versioned: true, Schema: schema})
+	require.NoError(t, g.Add(A, B))
+	require.NoError(t, SetAttributes(g, A, Attribute{Key: "team", Value: "web"}))
+	g.Associate(A, calls, B)
+	v, err := CurrentVersion(g)
+	require.NoError(t, err)
+
+	require.NoError(t, SetAttributes(g, A, Attribute{Key: "team", Value: "db"}))
+	schema.Kinds = map[EdgeKind]KindSchema{calls: {Required: []string{"rate"}}}
+
+	// The nodes have the attributes of the version, and the current schema is not checked
+	past, err := AsOf(g, v)
+	require.NoError(t, err)
+	require.Equal(t, A, past.Node("A").(*nodeT))
+	attrs, err := NodeAttributes(past, A)
+	require.NoError(t, err)
+	require.Equal(t, "web", attrs["team"])
+	require.Equal(t, "db", A.Attributes()["team"])
+	require.NotNil(t, past.Edge(past.Node("A"), calls, past.Node("B")))
+
+	first, err := AsOf(g, 2)
+	require.NoError(t, err)
+	attrs, err = NodeAttributes(first, A)
+	require.NoError(t, err)
+	require.Nil(t, attrs["team"])
+
+	// Built again from the earlier version, and kept for the next call
+	again, err := AsOf(g, v)
+	require.NoError(t, err)
+	require.True(t, past == again)
+	later, err := AsOf(g, v+1)
+	require.NoError(t, err)
+	attrs, err = NodeAttributes(later, A)
+	require.NoError(t, err)
+	require.Equal(t, "db", attrs["team"])
+	attrs, err = NodeAttributes(past, A)
+	require.NoError(t, err)
+	require.Equal(t, "web", attrs["team"])
+}
+
+func TestVersionAt(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+
+	_, err := VersionAt(Builder(Options{}), time.Now())
+	require.Error(t, err)
+
+	g := Builder(Options{Versioned: true})
+	before := time.Now()
+	require.NoError(t, g.Add(A))
+	middle := time.Now()
+	require.NoError(t, g.Add(B))
+
+	v, err := VersionAt(g, before)
+	require.NoError(t, err)
+	require.Equal(t, Version(0), v)
+	v, err = VersionAt(g, middle)
+	require.NoError(t, err)
+	require.Equal(t, Version(1), v)
+	v, err = VersionAt(g, time.Now())
+	require.NoError(t, err)
+	require.Equal(t, Version(2), v)
+
+	at, err := VersionTime(g, 1)
+	require.NoError(t, err)
+	require.False(t, at.Before(before))
+	require.False(t, at.After(middle))
+	_, err = VersionTime(g, 3)
+	require.Equal(t, ErrNoVersion{Version: 3}, err)
+
+	past, err := AsOf(g, v-1)
+	require.NoError(t, err)
+	require.Nil(t, past.Node("B"))
+}
+
+func TestAsOfShared(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+	calls := EdgeKind("calls")
+
+	g := Builder(Options{Versioned: true})
+	require.NoError(t, g.Add(A, B))
+	g.Associate(A, calls, B)
+
+	// The graph and its clone share the history, and each records its own changes
+	clone, err := Clone(g)
+	require.NoError(t, err)
+	require.NoError(t, g.Disassociate(A, calls, B))
+	clone.Associate(B, calls, A)
+
+	edges, err := EdgeHistory(clone, "A", calls, "B")
+	require.NoError(t, err)
+	require.Equal(t, Version(0), edges[0].ValidTo)
+	edges, err = EdgeHistory(g, "A", calls, "B")
+	require.NoError(t, err)
+	require.Equal(t, Version(4), edges[0].ValidTo)
+	edges, err = EdgeHistory(g, "B", calls, "A")
+	require.NoError(t, err)
+	require.Empty(t, edges)
+}
+
+func TestAsOfBatch(t *testing.T) {
+
+	A := &nodeT{id: "A"}
+	B := &nodeT{id: "B"}
+
+	g := Builder(Options{Versioned: true})
+	require.NoError(t, g.Add(A))
+	require.Error(t, g.Batch(func(tx GraphBuilder) error {
+		return tx.Add(A, &nodeT{id: "A"})
+	}))
+	require.NoError(t, g.Batch(func(tx GraphBuilder) error {
+		tx.Add(B)
+		_, err := tx.Associate(A, EdgeKind("calls"), B)
+		return err
+	}))
+
+	v, err := CurrentVersion(g)
+	require.NoError(t, err)
+	require.Equal(t, Version(3), v)
+
+	past, err := AsOf(g, 1)
+	require.NoError(t, err)
+	require.Nil(t, past.Node("B"))
+}
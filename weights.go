@@ -0,0 +1,41 @@
+package xgraph // import "github.com/orkestr8/xgraph"
+
+// EdgeWeightFunc returns the weight of an edge, for example a cost or a capacity.
+type EdgeWeightFunc func(Edge) float64
+
+// EdgeAttributeWeight returns an EdgeWeightFunc that reads a numeric edge attribute.
+// Edges without the attribute, or with a value that is not a number, weigh def.
+func EdgeAttributeWeight(key string, def float64) EdgeWeightFunc {
+	return func(e Edge) float64 {
+		if v, ok := numberOf(e.Attributes()[key]); ok {
+			return v
+		}
+		return def
+	}
+}
+
+func unitWeight(Edge) float64 {
+	return 1
+}
+
+func numberOf(v interface{}) (float64, bool) {
+	o, ok := orderedOf(v)
+	if !ok || o.class != classNumber {
+		return 0, false
+	}
+	return o.number, true
+}
+
+// NodeWeightFunc returns the weight of a node, for example the duration of a task.
+type NodeWeightFunc func(Node) float64
+
+// NodeAttributeWeight returns a NodeWeightFunc that reads a numeric attribute of nodes
+// that are Attributers.  Other nodes, or values that are not numbers, weigh def.
+func NodeAttributeWeight(key string, def float64) NodeWeightFunc {
+	return func(n Node) float64 {
+		if v, ok := numberOf(nodeAttributes(n)[key]); ok {
+			return v
+		}
+		return def
+	}
+}